@@ -0,0 +1,508 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines helpers for reading and writing attribute lists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNoAttribute returned by the AttributeList getters when the
+	// attribute is absent.
+	ErrNoAttribute = errors.New("attribute absent")
+	// ErrInvalidAttribute returned when the attribute value doesn't
+	// conform to the expected type.
+	ErrInvalidAttribute = errors.New("invalid attribute value")
+	// ErrAttributeSyntax returned by ParseAttributeList for malformed
+	// attribute lists.
+	ErrAttributeSyntax = errors.New("attribute list syntax error")
+)
+
+// AttributeError describes the attribute which can't be read or
+// written. It wraps ErrNoAttribute or ErrInvalidAttribute.
+type AttributeError struct {
+	Name string
+	Err  error
+}
+
+func (e *AttributeError) Error() string {
+	return "attribute " + e.Name + ": " + e.Err.Error()
+}
+
+func (e *AttributeError) Unwrap() error {
+	return e.Err
+}
+
+func invalidAttribute(name, value string, cause error) error {
+	if cause == nil {
+		return &AttributeError{name, fmt.Errorf("%w %q", ErrInvalidAttribute, value)}
+	}
+	return &AttributeError{name, fmt.Errorf("%w %q: %v", ErrInvalidAttribute, value, cause)}
+}
+
+// Attribute is a single name=value pair of an attribute list (section
+// 4.2). Value of the quoted string is kept without the quotes.
+type Attribute struct {
+	Name   string
+	Value  string
+	Quoted bool
+}
+
+// Int returns the value as decimal-integer.
+func (a Attribute) Int() (int64, error) {
+	if a.Quoted {
+		return 0, invalidAttribute(a.Name, a.Value, errors.New("quoted string instead of decimal-integer"))
+	}
+	v, err := strconv.ParseInt(a.Value, 10, 64)
+	if err != nil {
+		return 0, invalidAttribute(a.Name, a.Value, err)
+	}
+	return v, nil
+}
+
+// Float returns the value as decimal-floating-point.
+func (a Attribute) Float() (float64, error) {
+	if a.Quoted {
+		return 0, invalidAttribute(a.Name, a.Value, errors.New("quoted string instead of decimal-floating-point"))
+	}
+	v, err := strconv.ParseFloat(a.Value, 64)
+	if err != nil {
+		return 0, invalidAttribute(a.Name, a.Value, err)
+	}
+	return v, nil
+}
+
+// QuotedString returns the value of quoted-string without the quotes.
+func (a Attribute) QuotedString() (string, error) {
+	if !a.Quoted {
+		return "", invalidAttribute(a.Name, a.Value, errors.New("quoted-string expected"))
+	}
+	return a.Value, nil
+}
+
+// Enum returns the value of enumerated-string. If any allowed values
+// passed the value must be one of them.
+func (a Attribute) Enum(allowed ...string) (string, error) {
+	if a.Quoted {
+		return "", invalidAttribute(a.Name, a.Value, errors.New("quoted string instead of enumerated-string"))
+	}
+	if len(allowed) == 0 {
+		return a.Value, nil
+	}
+	for _, v := range allowed {
+		if a.Value == v {
+			return a.Value, nil
+		}
+	}
+	return "", invalidAttribute(a.Name, a.Value, fmt.Errorf("must be one of %s", strings.Join(allowed, ", ")))
+}
+
+// Bool returns the value of YES/NO enumerated-string. The case of the
+// value is ignored as some encoders use lower case.
+func (a Attribute) Bool() (bool, error) {
+	switch {
+	case a.Quoted:
+	case strings.EqualFold(a.Value, "YES"):
+		return true, nil
+	case strings.EqualFold(a.Value, "NO"):
+		return false, nil
+	}
+	return false, invalidAttribute(a.Name, a.Value, errors.New("value must be YES or NO"))
+}
+
+// Resolution returns the value of decimal-resolution <width>x<height>.
+func (a Attribute) Resolution() (width, height int, err error) {
+	w, h, found := strings.Cut(a.Value, "x")
+	if a.Quoted || !found {
+		return 0, 0, invalidAttribute(a.Name, a.Value, errors.New("<width>x<height> expected"))
+	}
+	if width, err = strconv.Atoi(w); err != nil {
+		return 0, 0, invalidAttribute(a.Name, a.Value, err)
+	}
+	if height, err = strconv.Atoi(h); err != nil {
+		return 0, 0, invalidAttribute(a.Name, a.Value, err)
+	}
+	return width, height, nil
+}
+
+// ByteRange returns the value of <n>[@<o>] byte range. The offset is
+// zero when absent. Both quoted and unquoted values are accepted.
+func (a Attribute) ByteRange() (length, offset int64, err error) {
+	n, o, hasOffset := strings.Cut(a.Value, "@")
+	if length, err = strconv.ParseInt(n, 10, 64); err != nil {
+		return 0, 0, invalidAttribute(a.Name, a.Value, err)
+	}
+	if hasOffset {
+		if offset, err = strconv.ParseInt(o, 10, 64); err != nil {
+			return 0, 0, invalidAttribute(a.Name, a.Value, err)
+		}
+	}
+	return length, offset, nil
+}
+
+// AttributeList represents attribute list of a tag in the order the
+// attributes appear.
+type AttributeList []Attribute
+
+// ParseAttributeList parses the attribute list. The value should not
+// include the tag and ':'. It returns ErrAttributeSyntax for malformed
+// lists but the attributes decoded before the error are returned too.
+func ParseAttributeList(value string) (AttributeList, error) {
+	return parseAttributeList(value, 0)
+}
+
+// parseAttributeList parses no more than max attributes when max
+// is positive. Exceeding the limit is reported with
+// ErrTooManyAttributes.
+func parseAttributeList(value string, max int) (AttributeList, error) {
+	var (
+		list AttributeList
+		err  error
+	)
+	for value != "" {
+		value = strings.TrimLeft(value, ", \t")
+		if value == "" {
+			break
+		}
+		eq := strings.IndexAny(value, "=,")
+		if eq < 0 || value[eq] == ',' {
+			if err == nil {
+				err = fmt.Errorf("%w: attribute without value at %q", ErrAttributeSyntax, value)
+			}
+			if eq < 0 {
+				break
+			}
+			value = value[eq:]
+			continue
+		}
+		a := Attribute{Name: strings.TrimSpace(value[:eq])}
+		value = strings.TrimLeft(value[eq+1:], " \t")
+		if strings.HasPrefix(value, `"`) {
+			end := strings.IndexByte(value[1:], '"')
+			if end < 0 {
+				if err == nil {
+					err = fmt.Errorf("%w: unterminated quoted string in %s", ErrAttributeSyntax, a.Name)
+				}
+				a.Value, value = value[1:], ""
+			} else {
+				a.Value, value = value[1:end+1], value[end+2:]
+			}
+			a.Quoted = true
+		} else {
+			end := strings.IndexByte(value, ',')
+			if end < 0 {
+				end = len(value)
+			}
+			a.Value, value = strings.TrimSpace(value[:end]), value[end:]
+		}
+		if max > 0 && len(list) >= max {
+			return list, ErrTooManyAttributes
+		}
+		list = append(list, a)
+	}
+	return list, err
+}
+
+// Get returns the named attribute.
+func (l AttributeList) Get(name string) (Attribute, bool) {
+	for _, a := range l {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// Has reports whether the named attribute is present.
+func (l AttributeList) Has(name string) bool {
+	_, ok := l.Get(name)
+	return ok
+}
+
+// Map returns the attributes as name, value map.
+func (l AttributeList) Map() map[string]string {
+	out := make(map[string]string, len(l))
+	for _, a := range l {
+		out[a.Name] = a.Value
+	}
+	return out
+}
+
+// MarshalText encodes the attribute as name=value. Quoted values
+// which can't be quoted-string and unquoted values which would break
+// the attribute list are reported as errors.
+func (a Attribute) MarshalText() ([]byte, error) {
+	return AttributeList{a}.MarshalText()
+}
+
+// UnmarshalText decodes the single name=value attribute.
+func (a *Attribute) UnmarshalText(text []byte) error {
+	list, err := ParseAttributeList(string(text))
+	if err != nil {
+		return err
+	}
+	if len(list) != 1 {
+		return fmt.Errorf("%w: %d attributes instead of one", ErrAttributeSyntax, len(list))
+	}
+	*a = list[0]
+	return nil
+}
+
+// MarshalText encodes the attribute list with the same checks as
+// Attribute.MarshalText.
+func (l AttributeList) MarshalText() ([]byte, error) {
+	var buf strings.Builder
+	w := NewStrictAttributeWriter(&buf)
+	for _, a := range l {
+		if a.Quoted {
+			w.QuotedString(a.Name, a.Value)
+		} else {
+			w.Enum(a.Name, a.Value)
+		}
+	}
+	if err := w.Err(); err != nil {
+		return nil, err
+	}
+	return []byte(buf.String()), nil
+}
+
+// UnmarshalText decodes the attribute list like ParseAttributeList
+// but keeps the list unchanged on syntax errors.
+func (l *AttributeList) UnmarshalText(text []byte) error {
+	list, err := ParseAttributeList(string(text))
+	if err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func (l AttributeList) get(name string) (Attribute, error) {
+	a, ok := l.Get(name)
+	if !ok {
+		return a, &AttributeError{name, ErrNoAttribute}
+	}
+	return a, nil
+}
+
+// Int returns the named attribute as decimal-integer.
+func (l AttributeList) Int(name string) (int64, error) {
+	a, err := l.get(name)
+	if err != nil {
+		return 0, err
+	}
+	return a.Int()
+}
+
+// Float returns the named attribute as decimal-floating-point.
+func (l AttributeList) Float(name string) (float64, error) {
+	a, err := l.get(name)
+	if err != nil {
+		return 0, err
+	}
+	return a.Float()
+}
+
+// QuotedString returns the named attribute as quoted-string.
+func (l AttributeList) QuotedString(name string) (string, error) {
+	a, err := l.get(name)
+	if err != nil {
+		return "", err
+	}
+	return a.QuotedString()
+}
+
+// Enum returns the named attribute as enumerated-string which must be
+// one of the allowed values if any passed.
+func (l AttributeList) Enum(name string, allowed ...string) (string, error) {
+	a, err := l.get(name)
+	if err != nil {
+		return "", err
+	}
+	return a.Enum(allowed...)
+}
+
+// Bool returns the named YES/NO attribute.
+func (l AttributeList) Bool(name string) (bool, error) {
+	a, err := l.get(name)
+	if err != nil {
+		return false, err
+	}
+	return a.Bool()
+}
+
+// Resolution returns the named attribute as decimal-resolution.
+func (l AttributeList) Resolution(name string) (width, height int, err error) {
+	a, err := l.get(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a.Resolution()
+}
+
+// ByteRange returns the named attribute as <n>[@<o>] byte range.
+func (l AttributeList) ByteRange(name string) (length, offset int64, err error) {
+	a, err := l.get(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a.ByteRange()
+}
+
+// AttributeWriter writes attribute list, it puts commas between the
+// attributes and quotes the values where required. Quoted strings
+// can't contain double quotes and line breaks so these characters are
+// percent-encoded. The first error is kept and reported by Err, the
+// following writes are ignored.
+type AttributeWriter struct {
+	w      io.StringWriter
+	n      int
+	err    error
+	strict bool
+}
+
+// NewAttributeWriter creates the writer of attribute list.
+func NewAttributeWriter(w io.StringWriter) *AttributeWriter {
+	return &AttributeWriter{w: w}
+}
+
+// NewStrictAttributeWriter creates the writer of attribute list which
+// reports the values not allowed by the attribute types as errors
+// instead of fixing them: quoted strings with double quotes or line
+// breaks, not finite floats and negative byte ranges.
+func NewStrictAttributeWriter(w io.StringWriter) *AttributeWriter {
+	return &AttributeWriter{w: w, strict: true}
+}
+
+// fail keeps the error of the strict writer.
+func (w *AttributeWriter) fail(name, value string, reason string) {
+	if w.strict && w.err == nil {
+		w.err = invalidAttribute(name, value, errors.New(reason))
+	}
+}
+
+// Err returns the first error occurred on writing.
+func (w *AttributeWriter) Err() error {
+	return w.err
+}
+
+func (w *AttributeWriter) write(name string, parts ...string) {
+	if w.err != nil {
+		return
+	}
+	if w.n > 0 {
+		_, w.err = w.w.WriteString(",")
+	}
+	w.n++
+	if w.err == nil {
+		_, w.err = w.w.WriteString(name)
+	}
+	if w.err == nil {
+		_, w.err = w.w.WriteString("=")
+	}
+	for _, s := range parts {
+		if w.err != nil {
+			return
+		}
+		_, w.err = w.w.WriteString(s)
+	}
+}
+
+// Int writes decimal-integer attribute.
+func (w *AttributeWriter) Int(name string, value int64) {
+	w.write(name, strconv.FormatInt(value, 10))
+}
+
+// Uint writes decimal-integer attribute.
+func (w *AttributeWriter) Uint(name string, value uint64) {
+	w.write(name, strconv.FormatUint(value, 10))
+}
+
+// Float writes decimal-floating-point attribute with the precision
+// (-1 means the shortest representation).
+func (w *AttributeWriter) Float(name string, value float64, prec int) {
+	if w.strict && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		w.fail(name, strconv.FormatFloat(value, 'f', -1, 64), "not a decimal-floating-point")
+		return
+	}
+	w.write(name, strconv.FormatFloat(value, 'f', prec, 64))
+}
+
+// QuotedString writes quoted-string attribute.
+func (w *AttributeWriter) QuotedString(name, value string) {
+	if w.strict && strings.ContainsAny(value, "\"\r\n") {
+		w.fail(name, value, "not a quoted-string")
+		return
+	}
+	w.write(name, `"`, EscapeQuotedString(value), `"`)
+}
+
+// Enum writes enumerated-string attribute. Values which would break
+// the attribute list are reported as errors by the strict writer and
+// written as is by the other one.
+func (w *AttributeWriter) Enum(name, value string) {
+	if w.strict && (value == "" || strings.ContainsAny(value, "\",\r\n \t")) {
+		w.fail(name, value, "not an enumerated-string")
+		return
+	}
+	w.write(name, value)
+}
+
+// Raw writes the value as is. The caller is responsible for its
+// syntax.
+func (w *AttributeWriter) Raw(name, value string) {
+	w.write(name, value)
+}
+
+// Bool writes YES/NO attribute.
+func (w *AttributeWriter) Bool(name string, value bool) {
+	if value {
+		w.write(name, "YES")
+	} else {
+		w.write(name, "NO")
+	}
+}
+
+// Resolution writes decimal-resolution attribute.
+func (w *AttributeWriter) Resolution(name string, width, height int) {
+	w.write(name, strconv.Itoa(width), "x", strconv.Itoa(height))
+}
+
+// ByteRange writes <n>[@<o>] byte range as quoted-string. Zero offset
+// is omitted.
+func (w *AttributeWriter) ByteRange(name string, length, offset int64) {
+	if w.strict && (length < 0 || offset < 0) {
+		w.fail(name, strconv.FormatInt(length, 10)+"@"+strconv.FormatInt(offset, 10), "negative byte range")
+		return
+	}
+	if offset == 0 {
+		w.write(name, `"`, strconv.FormatInt(length, 10), `"`)
+		return
+	}
+	w.write(name, `"`, strconv.FormatInt(length, 10), "@", strconv.FormatInt(offset, 10), `"`)
+}
+
+// EscapeQuotedString percent-encodes the characters which can't
+// appear in quoted-string: double quote, CR and LF.
+func EscapeQuotedString(value string) string {
+	if !strings.ContainsAny(value, "\"\r\n") {
+		return value
+	}
+	return quotedStringEscaper.Replace(value)
+}
+
+var quotedStringEscaper = strings.NewReplacer(`"`, "%22", "\r", "%0D", "\n", "%0A")
@@ -0,0 +1,172 @@
+/*
+Attribute list tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAttributeList(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected AttributeList
+		err      error
+	}{
+		{
+			`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=640x360`,
+			AttributeList{{"BANDWIDTH", "1280000", false}, {"CODECS", "avc1.4d401f,mp4a.40.2", true}, {"RESOLUTION", "640x360", false}},
+			nil,
+		},
+		{
+			`NAME="", DEFAULT=YES`,
+			AttributeList{{"NAME", "", true}, {"DEFAULT", "YES", false}},
+			nil,
+		},
+		{
+			`ElapsedTime=5.005,SCTE35=/DAlAAAAAAAAAP/wFAUAAAABf+==`,
+			AttributeList{{"ElapsedTime", "5.005", false}, {"SCTE35", "/DAlAAAAAAAAAP/wFAUAAAABf+==", false}},
+			nil,
+		},
+		{
+			`URI="unterminated`,
+			AttributeList{{"URI", "unterminated", true}},
+			ErrAttributeSyntax,
+		},
+		{
+			`NOVALUE,ID=1`,
+			AttributeList{{"ID", "1", false}},
+			ErrAttributeSyntax,
+		},
+		{"", nil, nil},
+	}
+	for _, test := range tests {
+		attrs, err := ParseAttributeList(test.src)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, expected %v", test.src, err, test.err)
+		}
+		if !reflect.DeepEqual(attrs, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.src, attrs, test.expected)
+		}
+	}
+}
+
+func TestAttributeListGetters(t *testing.T) {
+	attrs, err := ParseAttributeList(`INT=42,FLOAT=29.97,STR="text",ENUM=AUDIO,BOOL=YES,RES=1920x1080,RANGE="1024@2048",QINT="42"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := attrs.Int("INT"); err != nil || v != 42 {
+		t.Errorf("Int: got %v, %v", v, err)
+	}
+	if v, err := attrs.Float("FLOAT"); err != nil || v != 29.97 {
+		t.Errorf("Float: got %v, %v", v, err)
+	}
+	if v, err := attrs.QuotedString("STR"); err != nil || v != "text" {
+		t.Errorf("QuotedString: got %v, %v", v, err)
+	}
+	if v, err := attrs.Enum("ENUM", "AUDIO", "VIDEO"); err != nil || v != "AUDIO" {
+		t.Errorf("Enum: got %v, %v", v, err)
+	}
+	if v, err := attrs.Bool("BOOL"); err != nil || !v {
+		t.Errorf("Bool: got %v, %v", v, err)
+	}
+	if w, h, err := attrs.Resolution("RES"); err != nil || w != 1920 || h != 1080 {
+		t.Errorf("Resolution: got %vx%v, %v", w, h, err)
+	}
+	if n, o, err := attrs.ByteRange("RANGE"); err != nil || n != 1024 || o != 2048 {
+		t.Errorf("ByteRange: got %v@%v, %v", n, o, err)
+	}
+
+	invalid := []error{}
+	_, err = attrs.Int("QINT")
+	invalid = append(invalid, err)
+	_, err = attrs.Float("STR")
+	invalid = append(invalid, err)
+	_, err = attrs.QuotedString("INT")
+	invalid = append(invalid, err)
+	_, err = attrs.Enum("ENUM", "VIDEO")
+	invalid = append(invalid, err)
+	_, err = attrs.Bool("INT")
+	invalid = append(invalid, err)
+	_, _, err = attrs.Resolution("INT")
+	invalid = append(invalid, err)
+	_, _, err = attrs.ByteRange("STR")
+	invalid = append(invalid, err)
+	for i, err := range invalid {
+		var attrErr *AttributeError
+		if !errors.Is(err, ErrInvalidAttribute) || !errors.As(err, &attrErr) {
+			t.Errorf("Getter %d: got error %v, expected ErrInvalidAttribute", i, err)
+		}
+	}
+	if _, err = attrs.Int("ABSENT"); !errors.Is(err, ErrNoAttribute) {
+		t.Errorf("Got error %v, expected ErrNoAttribute", err)
+	}
+}
+
+func TestAttributeWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewAttributeWriter(buf)
+	w.Enum("TYPE", "AUDIO")
+	w.QuotedString("NAME", "Say \"hi\"\nto all")
+	w.Int("INT", -1)
+	w.Uint("UINT", 7)
+	w.Float("FRAME-RATE", 25, 3)
+	w.Bool("DEFAULT", false)
+	w.Resolution("RESOLUTION", 640, 360)
+	w.ByteRange("BYTERANGE", 100, 0)
+	if err := w.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expected := `TYPE=AUDIO,NAME="Say %22hi%22%0Ato all",INT=-1,UINT=7,FRAME-RATE=25.000,DEFAULT=NO,RESOLUTION=640x360,BYTERANGE="100"`
+	if buf.String() != expected {
+		t.Errorf("Got %s\nexpected %s", buf.String(), expected)
+	}
+
+	attrs, err := ParseAttributeList(buf.String())
+	if err != nil || len(attrs) != 8 {
+		t.Errorf("Written list can't be parsed back: %v, %v", attrs, err)
+	}
+
+	// the values are written as is by the non-strict writer
+	w.Enum("BAD", "NOT ENUM")
+	w.Int("NEXT", 1)
+	if err := w.Err(); err != nil || !strings.HasSuffix(buf.String(), ",BAD=NOT ENUM,NEXT=1") {
+		t.Errorf("Got %s, %v", buf.String(), err)
+	}
+
+	strict := NewStrictAttributeWriter(new(bytes.Buffer))
+	strict.Enum("BAD", "NOT ENUM")
+	if !errors.Is(strict.Err(), ErrInvalidAttribute) {
+		t.Errorf("Got error %v, expected ErrInvalidAttribute", strict.Err())
+	}
+}
+
+func TestEncodeAlternativeWithForbiddenCharacters(t *testing.T) {
+	m := NewMasterPlaylist()
+	m.Append("chunklist.m3u8", nil, VariantParams{
+		Bandwidth: 1500000,
+		Audio:     "aac",
+		Alternatives: []*Alternative{
+			{GroupId: "aac", Type: "AUDIO", Name: "Director's \"cut\"\n", URI: "audio.m3u8"},
+		},
+	})
+	p, _, err := DecodeFrom(m.Encode(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alt := p.(*MasterPlaylist).Variants[0].Alternatives[0]
+	if alt.Name != `Director's %22cut%22%0A` || alt.URI != "audio.m3u8" {
+		t.Errorf("Got rendition %+v", alt)
+	}
+}
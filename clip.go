@@ -0,0 +1,137 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines clipping of media playlists by time.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrEmptyClip returned by Clip and ClipTime when no segments of the
+// playlist fall in the range.
+var ErrEmptyClip = errors.New("no segments in the clip range")
+
+// Clip returns a new VOD playlist with the segments overlapping the
+// media time range [from, to). The time is counted from the start of
+// the first segment of the playlist. EXT-X-START points to the exact
+// in-point inside the first segment. See ClipTime for the state
+// carried to the first segment.
+func (p *MediaPlaylist) Clip(from, to time.Duration) (*MediaPlaylist, error) {
+	if to <= from {
+		return nil, fmt.Errorf("invalid clip range %v-%v", from, to)
+	}
+	segments := p.segments()
+	first, last := -1, -1
+	var start, offset float64
+	for i, seg := range segments {
+		end := start + seg.Duration
+		if start < to.Seconds() && end > from.Seconds() {
+			if first < 0 {
+				first, offset = i, from.Seconds()-start
+			}
+			last = i
+		}
+		start = end
+	}
+	if first < 0 {
+		return nil, ErrEmptyClip
+	}
+	return p.clip(segments, first, last, offset), nil
+}
+
+// ClipTime returns a new VOD playlist with the segments overlapping
+// the wall-clock range [from, to). The time of the segments is
+// interpolated from EXT-X-PROGRAM-DATE-TIME as ProgramDateTimes does.
+// The key, the map and the program date time in effect for the first
+// segment are set on it, the discontinuities of the skipped segments
+// are counted in EXT-X-DISCONTINUITY-SEQUENCE. Segments are copied so
+// the playlist stays unchanged.
+func (p *MediaPlaylist) ClipTime(from, to time.Time) (*MediaPlaylist, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid clip range %v-%v", from, to)
+	}
+	segments := p.segments()
+	pdts := programDateTimes(segments)
+	first, last := -1, -1
+	var offset float64
+	for i, seg := range segments {
+		if pdts[i].IsZero() {
+			continue
+		}
+		if pdts[i].Before(to) && pdts[i].Add(seconds(seg.Duration)).After(from) {
+			if first < 0 {
+				first, offset = i, from.Sub(pdts[i]).Seconds()
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return nil, ErrEmptyClip
+	}
+	return p.clip(segments, first, last, offset), nil
+}
+
+// clip copies the segments from first to last into a new VOD
+// playlist. The offset of the in-point in the first segment is
+// negative when the range starts before it.
+func (p *MediaPlaylist) clip(segments []*MediaSegment, first, last int, offset float64) *MediaPlaylist {
+	result, _ := NewMediaPlaylist(0, uint(last-first+1))
+	result.SeqNo = segments[first].SeqId
+	result.TargetDuration = 0
+	result.Iframe = p.Iframe
+	result.Args = p.Args
+	result.WV = p.WV
+	result.DiscontinuitySeq = p.DiscontinuitySeq
+	result.encoder = p.encoder
+
+	key, m := p.Key, p.Map
+	for i, seg := range segments[:first+1] {
+		if seg.Key != nil {
+			key = seg.Key
+		}
+		if seg.Map != nil {
+			m = seg.Map
+		}
+		if i < first && seg.Discontinuity != nil {
+			result.DiscontinuitySeq++
+		}
+	}
+
+	for i, seg := range segments[first : last+1] {
+		s := *seg
+		if i == 0 {
+			if encryptionKey(key) != nil {
+				s.Key = key
+			} else {
+				s.Key = nil
+			}
+			s.Map = m
+			s.ProgramDateTime = programDateTimes(segments)[first]
+		}
+		// can't fail, the capacity fits the segments
+		_ = result.AppendSegment(&s)
+	}
+	if offset > 0 {
+		result.StartTime = offset
+		result.StartTimePrecise = true
+	}
+	result.Close()
+	result.MediaType = VOD
+	result.ver = result.RequiredVersion()
+	return result
+}
+
+// seconds converts the duration in seconds to time.Duration.
+func seconds(duration float64) time.Duration {
+	return time.Duration(duration * float64(time.Second))
+}
@@ -0,0 +1,120 @@
+/*
+Playlist clipping tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+const dvrPlaylist = `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:50
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00Z
+#EXTINF:10,
+s50.m4s
+#EXTINF:10,
+s51.m4s
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:05:00Z
+#EXTINF:6,
+s52.m4s
+#EXTINF:6,
+s53.m4s
+#EXTINF:6,
+s54.m4s
+`
+
+func TestClip(t *testing.T) {
+	p := decodeMedia(t, dvrPlaylist)
+	clip, err := p.Clip(23*time.Second, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MEDIA-SEQUENCE:52
+#EXT-X-TARGETDURATION:6
+#EXT-X-START:TIME-OFFSET=3,PRECISE=YES
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:05:00Z
+#EXTINF:6.000,
+s52.m4s
+#EXTINF:6.000,
+s53.m4s
+#EXT-X-ENDLIST
+`
+	if clip.String() != expected {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", clip, expected)
+	}
+
+	// the program date time is carried to the first segment
+	clip, err = p.Clip(10*time.Second, 20*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := clip.segments()
+	if len(segs) != 1 || segs[0].URI != "s51.m4s" || clip.StartTime != 0 {
+		t.Fatalf("Got playlist\n%s", clip)
+	}
+	if pdt := time.Date(2020, 1, 1, 10, 0, 10, 0, time.UTC); !segs[0].ProgramDateTime.Equal(pdt) {
+		t.Errorf("Got program date time %v, expected %v", segs[0].ProgramDateTime, pdt)
+	}
+	if p.Segments[1].Key != nil || !p.Segments[1].ProgramDateTime.IsZero() {
+		t.Error("Source playlist is changed")
+	}
+
+	if _, err = p.Clip(time.Minute, 2*time.Minute); !errors.Is(err, ErrEmptyClip) {
+		t.Errorf("Got error %v, expected %v", err, ErrEmptyClip)
+	}
+	if _, err = p.Clip(time.Minute, time.Second); err == nil {
+		t.Error("No error for the reversed range")
+	}
+}
+
+func TestClipTime(t *testing.T) {
+	p := decodeMedia(t, dvrPlaylist)
+	from := time.Date(2020, 1, 1, 10, 0, 5, 0, time.UTC)
+	clip, err := p.ClipTime(from, from.Add(6*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uris []string
+	for _, seg := range clip.segments() {
+		uris = append(uris, seg.URI)
+	}
+	if len(uris) != 5 || uris[0] != "s50.m4s" || clip.StartTime != 5 || !clip.StartTimePrecise {
+		t.Errorf("Got segments %v and start %v", uris, clip.StartTime)
+	}
+	if clip.DiscontinuitySeq != 0 || clip.MediaType != VOD || !clip.Closed {
+		t.Errorf("Got playlist\n%s", clip)
+	}
+
+	// the gap before the discontinuity has no segments
+	from = time.Date(2020, 1, 1, 10, 1, 0, 0, time.UTC)
+	if _, err = p.ClipTime(from, from.Add(time.Minute)); !errors.Is(err, ErrEmptyClip) {
+		t.Errorf("Got error %v, expected %v", err, ErrEmptyClip)
+	}
+	clip, err = p.ClipTime(from, from.Add(4*time.Minute+7*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segs := clip.segments(); len(segs) != 2 || segs[0].SeqId != 52 || clip.StartTime != 0 || clip.DiscontinuitySeq != 0 {
+		t.Errorf("Got playlist\n%s", clip)
+	}
+}
@@ -0,0 +1,488 @@
+// Command m3u8 parses, formats, lints and describes HLS playlists.
+//
+// Usage:
+//
+//	m3u8 parse [file ...]
+//	m3u8 fmt [-w] [file ...]
+//	m3u8 lint [-profile rfc8216|apple] [-warnings] [file ...]
+//	m3u8 info [file ...]
+//
+// Playlists are read from the files or from the standard input when
+// no files are given or the file is "-". They are decoded strictly,
+// the first syntax error stops the command. The exit code is 0 on
+// success, 1 when lint finds problems and 2 when the playlists can't
+// be read or decoded or the command line is wrong.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/135yshr/m3u8"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitProblems = 1
+	exitError    = 2
+)
+
+const usage = `usage: m3u8 <command> [flags] [file ...]
+
+commands:
+  parse   detect playlist type and dump its structure
+  fmt     normalize and re-encode playlists
+  lint    report spec problems with line numbers
+  info    summarize playlists
+
+Playlists are read from the standard input when no files are given.
+Exit code is 0 on success, 1 when lint finds problems, 2 on errors.
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	cmd := &command{stdin: stdin, stdout: stdout, stderr: stderr}
+	switch args[0] {
+	case "parse":
+		return cmd.runParse(args[1:])
+	case "fmt":
+		return cmd.runFmt(args[1:])
+	case "lint":
+		return cmd.runLint(args[1:])
+	case "info":
+		return cmd.runInfo(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	}
+	fmt.Fprintf(stderr, "m3u8: unknown command %q\n%s", args[0], usage)
+	return exitError
+}
+
+type command struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// input is the decoded playlist with the lines of its source.
+type input struct {
+	name     string
+	playlist m3u8.Playlist
+	listType m3u8.ListType
+	lines    m3u8.LineIndex
+}
+
+func (c *command) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// each decodes the named files or the standard input and calls the
+// function for each of them. It returns false if any of the inputs
+// can't be read or decoded.
+func (c *command) each(names []string, fn func(in *input) error) bool {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	ok := true
+	for _, name := range names {
+		in, err := c.read(name)
+		if err == nil {
+			err = fn(in)
+		}
+		if err != nil {
+			fmt.Fprintf(c.stderr, "m3u8: %v\n", err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (c *command) read(name string) (*input, error) {
+	var (
+		src []byte
+		err error
+	)
+	if name == "-" {
+		name = "<stdin>"
+		src, err = io.ReadAll(c.stdin)
+	} else {
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// decode strictly so that fmt never rewrites the input it couldn't
+	// parse and lint doesn't pass it
+	lines := make(m3u8.LineIndex)
+	p, listType, err := m3u8.DecodeWithOptions(bytes.NewReader(src), m3u8.DecoderOptions{Strict: true, Lines: lines})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if media, ok := p.(*m3u8.MediaPlaylist); ok {
+		// show all the segments of live playlists too
+		media.SetWinSize(0)
+	}
+	return &input{name: name, playlist: p, listType: listType, lines: lines}, nil
+}
+
+func (c *command) runParse(args []string) int {
+	fs := c.flags("parse")
+	if fs.Parse(args) != nil {
+		return exitError
+	}
+	ok := c.each(fs.Args(), func(in *input) error {
+		fmt.Fprintf(c.stdout, "%s:\n", in.name)
+		switch p := in.playlist.(type) {
+		case *m3u8.MasterPlaylist:
+			dumpMaster(c.stdout, p)
+		case *m3u8.MediaPlaylist:
+			dumpMedia(c.stdout, p)
+		}
+		return nil
+	})
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+func (c *command) runFmt(args []string) int {
+	fs := c.flags("fmt")
+	write := fs.Bool("w", false, "write result to the source file instead of stdout")
+	if fs.Parse(args) != nil {
+		return exitError
+	}
+	if *write && len(fs.Args()) == 0 {
+		fmt.Fprintln(c.stderr, "m3u8: -w requires files")
+		return exitError
+	}
+	ok := c.each(fs.Args(), func(in *input) error {
+		var (
+			out *bytes.Buffer
+			err error
+		)
+		switch p := in.playlist.(type) {
+		case *m3u8.MasterPlaylist:
+			out, err = p.EncodeStrict()
+		case *m3u8.MediaPlaylist:
+			out, err = p.EncodeStrict()
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+		if *write {
+			return replaceFile(in.name, out.Bytes())
+		}
+		_, err = out.WriteTo(c.stdout)
+		return err
+	})
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+// replaceFile replaces the content of the file keeping its mode. The
+// data is written to a temporary file in the same directory which is
+// renamed over the original one, so the file is never left truncated.
+func replaceFile(name string, data []byte) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after the rename
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (c *command) runLint(args []string) int {
+	fs := c.flags("lint")
+	profileName := fs.String("profile", "rfc8216", "lint profile: rfc8216 or apple")
+	warnings := fs.Bool("warnings", false, "fail on warnings too")
+	if fs.Parse(args) != nil {
+		return exitError
+	}
+	var profile m3u8.LintProfile
+	switch *profileName {
+	case "rfc8216":
+		profile = m3u8.ProfileRFC8216
+	case "apple":
+		profile = m3u8.ProfileAppleHLS
+	default:
+		fmt.Fprintf(c.stderr, "m3u8: unknown profile %q\n", *profileName)
+		return exitError
+	}
+	problems := false
+	ok := c.each(fs.Args(), func(in *input) error {
+		var violations []m3u8.Violation
+		switch p := in.playlist.(type) {
+		case *m3u8.MasterPlaylist:
+			violations = p.Lint(profile)
+		case *m3u8.MediaPlaylist:
+			violations = p.Lint(profile)
+		}
+		for _, v := range violations {
+			fmt.Fprintf(c.stdout, "%s:%d: %v\n", in.name, lineOf(in.lines, v), v)
+			if v.Severity == m3u8.SeverityError || *warnings {
+				problems = true
+			}
+		}
+		return nil
+	})
+	switch {
+	case !ok:
+		return exitError
+	case problems:
+		return exitProblems
+	}
+	return exitOK
+}
+
+func (c *command) runInfo(args []string) int {
+	fs := c.flags("info")
+	if fs.Parse(args) != nil {
+		return exitError
+	}
+	ok := c.each(fs.Args(), func(in *input) error {
+		fmt.Fprintf(c.stdout, "%s:\n", in.name)
+		switch p := in.playlist.(type) {
+		case *m3u8.MasterPlaylist:
+			infoMaster(c.stdout, p)
+		case *m3u8.MediaPlaylist:
+			infoMedia(c.stdout, p)
+		}
+		return nil
+	})
+	if !ok {
+		return exitError
+	}
+	return exitOK
+}
+
+func dumpMaster(w io.Writer, p *m3u8.MasterPlaylist) {
+	fmt.Fprintf(w, "  type: master\n  version: %d\n  independent segments: %v\n", p.Version(), p.IndependentSegments())
+	written := make(map[*m3u8.Alternative]bool)
+	for _, v := range p.Variants {
+		kind := "variant"
+		if v.Iframe {
+			kind = "i-frame variant"
+		}
+		fmt.Fprintf(w, "  %s %s\n", kind, v.URI)
+		fmt.Fprintf(w, "    bandwidth: %d\n", v.Bandwidth)
+		printField(w, "    ", "average bandwidth", v.AverageBandwidth)
+		printField(w, "    ", "codecs", v.Codecs)
+		printField(w, "    ", "resolution", v.Resolution)
+		printField(w, "    ", "frame rate", v.FrameRate)
+		printField(w, "    ", "video range", v.VideoRange)
+		printField(w, "    ", "audio", v.Audio)
+		printField(w, "    ", "video", v.Video)
+		printField(w, "    ", "subtitles", v.Subtitles)
+		printField(w, "    ", "closed captions", v.Captions)
+		printField(w, "    ", "stable variant id", v.StableVariantId)
+		for _, alt := range v.Alternatives {
+			if alt == nil || written[alt] {
+				continue
+			}
+			written[alt] = true
+			fmt.Fprintf(w, "    rendition %s %q of group %q\n", alt.Type, alt.Name, alt.GroupId)
+			printField(w, "      ", "language", alt.Language)
+			printField(w, "      ", "default", alt.Default)
+			printField(w, "      ", "uri", alt.URI)
+		}
+	}
+}
+
+func dumpMedia(w io.Writer, p *m3u8.MediaPlaylist) {
+	fmt.Fprintf(w, "  type: media\n  version: %d\n", p.Version())
+	printField(w, "  ", "playlist type", mediaType(p))
+	fmt.Fprintf(w, "  target duration: %v\n  media sequence: %d\n", p.TargetDuration, p.SeqNo)
+	printField(w, "  ", "discontinuity sequence", p.DiscontinuitySeq)
+	printField(w, "  ", "i-frames only", p.Iframe)
+	printField(w, "  ", "closed", p.Closed)
+	for _, seg := range p.GetAllSegments() {
+		if seg == nil {
+			continue
+		}
+		fmt.Fprintf(w, "  segment %d %s\n", seg.SeqId, seg.URI)
+		fmt.Fprintf(w, "    duration: %v\n", seg.Duration)
+		printField(w, "    ", "title", seg.Title)
+		if seg.Limit > 0 {
+			fmt.Fprintf(w, "    byte range: %d@%d\n", seg.Limit, seg.Offset)
+		}
+		if seg.Discontinuity != nil {
+			fmt.Fprintln(w, "    discontinuity")
+		}
+		if seg.Key != nil {
+			fmt.Fprintf(w, "    key: %s %s\n", seg.Key.Method, seg.Key.URI)
+		}
+		if seg.Map != nil {
+			fmt.Fprintf(w, "    map: %s\n", seg.Map.URI)
+		}
+		if !seg.ProgramDateTime.IsZero() {
+			fmt.Fprintf(w, "    program date time: %s\n", seg.ProgramDateTime.Format(m3u8.DATETIME))
+		}
+	}
+}
+
+// printField prints the field with the indent if it is not zero.
+func printField(w io.Writer, indent, name string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case bool:
+		if !v {
+			return
+		}
+	case uint32:
+		if v == 0 {
+			return
+		}
+	case uint64:
+		if v == 0 {
+			return
+		}
+	case float64:
+		if v == 0 {
+			return
+		}
+	}
+	fmt.Fprintf(w, "%s%s: %v\n", indent, name, value)
+}
+
+func mediaType(p *m3u8.MediaPlaylist) string {
+	switch p.MediaType {
+	case m3u8.EVENT:
+		return "EVENT"
+	case m3u8.VOD:
+		return "VOD"
+	}
+	return ""
+}
+
+func infoMaster(w io.Writer, p *m3u8.MasterPlaylist) {
+	var (
+		variants, iframes int
+		renditions        = make(map[*m3u8.Alternative]bool)
+		bandwidths        []int
+	)
+	for _, v := range p.Variants {
+		if v.Iframe {
+			iframes++
+		} else {
+			variants++
+			bandwidths = append(bandwidths, int(v.Bandwidth))
+		}
+		for _, alt := range v.Alternatives {
+			if alt != nil {
+				renditions[alt] = true
+			}
+		}
+	}
+	sort.Ints(bandwidths)
+	fmt.Fprintf(w, "  type: master\n  version: %d\n  variants: %d\n  i-frame variants: %d\n  renditions: %d\n",
+		p.Version(), variants, iframes, len(renditions))
+	if len(bandwidths) > 0 {
+		fmt.Fprintf(w, "  bandwidth: %d-%d\n", bandwidths[0], bandwidths[len(bandwidths)-1])
+	}
+}
+
+func infoMedia(w io.Writer, p *m3u8.MediaPlaylist) {
+	var (
+		segments, discontinuities, keys, maps int
+		duration                              float64
+		methods                               []string
+	)
+	for _, seg := range p.GetAllSegments() {
+		if seg == nil {
+			continue
+		}
+		segments++
+		duration += seg.Duration
+		if seg.Discontinuity != nil {
+			discontinuities++
+		}
+		if seg.Key != nil {
+			keys++
+			if !containsString(methods, seg.Key.Method) {
+				methods = append(methods, seg.Key.Method)
+			}
+		}
+		if seg.Map != nil {
+			maps++
+		}
+	}
+	kind := mediaType(p)
+	if kind == "" {
+		kind = "live"
+		if p.Closed {
+			kind = "closed"
+		}
+	}
+	fmt.Fprintf(w, "  type: media (%s)\n  version: %d\n  segments: %d\n  total duration: %.3f\n  target duration: %v\n  media sequence: %d\n  discontinuities: %d\n  keys: %d",
+		kind, p.Version(), segments, duration, p.TargetDuration, p.SeqNo, discontinuities, keys)
+	if len(methods) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(methods, ", "))
+	}
+	fmt.Fprintf(w, "\n  maps: %d\n", maps)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// lineOf returns the source line of the violation or 1 for the whole
+// playlist.
+func lineOf(lines m3u8.LineIndex, v m3u8.Violation) int {
+	var line int
+	switch obj := v.Object.(type) {
+	case *m3u8.MediaSegment, *m3u8.Variant, *m3u8.Alternative:
+		line = lines[obj]
+	default:
+		switch v.Rule {
+		case m3u8.RuleVersion:
+			line = lines["#EXT-X-VERSION"]
+		case m3u8.RuleAppleTargetDuration:
+			line = lines["#EXT-X-TARGETDURATION"]
+		}
+	}
+	if line == 0 {
+		line = 1
+	}
+	return line
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const brokenMaster = `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="de",URI="de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+#EXT-X-STREAM-INF:AUDIO="aac"
+high.m3u8
+`
+
+func runCommand(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestLint(t *testing.T) {
+	code, out, _ := runCommand(t, brokenMaster, "lint")
+	if code != exitProblems {
+		t.Errorf("Exit code %d, expected %d", code, exitProblems)
+	}
+	for _, expected := range []string{
+		"<stdin>:6: error: bandwidth:",
+		"<stdin>:3: error: name:",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Output doesn't contain %q:\n%s", expected, out)
+		}
+	}
+
+	// the lines come from the decoder, not from guessing over the source
+	repeated := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1280000\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n#EXT-X-STREAM-INF:AVERAGE-BANDWIDTH=1\nhigh.m3u8\n"
+	if _, out, _ = runCommand(t, repeated, "lint"); !strings.Contains(out, "<stdin>:5: error: bandwidth:") {
+		t.Errorf("Wrong line of the variant after the repeated tag:\n%s", out)
+	}
+	media := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-I-FRAMES-ONLY\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:10,\n#EXTINF:10,\n#EXT-X-BYTERANGE:100@0\na.ts\n#EXTINF:10,\nb.ts\n"
+	if _, out, _ = runCommand(t, media, "lint"); !strings.Contains(out, "<stdin>:9: warning: i-frames-only:") {
+		t.Errorf("Wrong line of the segment:\n%s", out)
+	}
+
+	ranged := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXT-X-BYTERANGE:100@0\n#EXTINF:10,\na.ts\n"
+	if code, out, _ = runCommand(t, ranged, "lint"); code != exitProblems || !strings.Contains(out, "error: version:") {
+		t.Errorf("Exit code %d and output %q for the declared version below the required one", code, out)
+	}
+
+	code, out, _ = runCommand(t, "", "lint", "../../sample-playlists/media-playlist-with-byterange.m3u8")
+	if code != exitOK || out != "" {
+		t.Errorf("Exit code %d and output %q for valid playlist", code, out)
+	}
+	code, out, _ = runCommand(t, "", "lint", "-profile", "apple", "../../sample-playlists/media-playlist-with-byterange.m3u8")
+	if code != exitOK || !strings.Contains(out, ":2: warning: apple-target-duration:") {
+		t.Errorf("Exit code %d and output %q for warnings", code, out)
+	}
+	code, _, _ = runCommand(t, "", "lint", "-profile", "apple", "-warnings", "../../sample-playlists/media-playlist-with-byterange.m3u8")
+	if code != exitProblems {
+		t.Errorf("Exit code %d, expected %d with -warnings", code, exitProblems)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		stdin string
+		args  []string
+	}{
+		{"", nil},
+		{"", []string{"unknown"}},
+		{"", []string{"lint", "-profile", "unknown"}},
+		{"not a playlist", []string{"parse"}},
+		{"#EXT-X-TARGETDURATION:10\n#EXTINF:10,\na.ts\n", []string{"lint"}},
+		{"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:ten,\na.ts\n", []string{"lint"}},
+		{"#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-BYTERANGE:x@y\n#EXTINF:10,\na.ts\n", []string{"info"}},
+		{"", []string{"info", "no-such-file.m3u8"}},
+		{"", []string{"fmt", "-w"}},
+	}
+	for _, tt := range tests {
+		if code, _, _ := runCommand(t, tt.stdin, tt.args...); code != exitError {
+			t.Errorf("%q: exit code %d, expected %d", tt.args, code, exitError)
+		}
+	}
+}
+
+func TestFmt(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:9.5,\na.ts\n#EXTINF:10,\nb.ts\n#EXT-X-ENDLIST\n"
+	expected := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:10\n#EXTINF:9.500,\na.ts\n#EXTINF:10.000,\nb.ts\n#EXT-X-ENDLIST\n"
+	code, out, errOut := runCommand(t, src, "fmt")
+	if code != exitOK || out != expected {
+		t.Fatalf("Exit code %d, stderr %q, output:\n%s", code, errOut, out)
+	}
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "media.m3u8")
+	if err := os.WriteFile(name, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCommand(t, "", "fmt", "-w", name); code != exitOK {
+		t.Fatalf("Exit code %d, stderr %q", code, errOut)
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != expected {
+		t.Errorf("File content after fmt -w:\n%s", data)
+	}
+	// the mode is kept and no temporary files are left
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Got file mode %v, %v", info.Mode(), err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("Got directory entries %v, %v", entries, err)
+	}
+
+	// the input which can't be parsed is not rewritten
+	broken := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:ten,\na.ts\n#EXTINF:10,\nb.ts\n"
+	if err := os.WriteFile(name, []byte(broken), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, _ := runCommand(t, "", "fmt", "-w", name); code != exitError {
+		t.Errorf("Exit code %d, expected %d for broken playlist", code, exitError)
+	}
+	if data, err := os.ReadFile(name); err != nil || string(data) != broken {
+		t.Errorf("Broken file is rewritten:\n%s", data)
+	}
+}
+
+func TestParseAndInfo(t *testing.T) {
+	code, out, _ := runCommand(t, brokenMaster, "parse")
+	if code != exitOK || !strings.Contains(out, "  variant high.m3u8\n") || !strings.Contains(out, `rendition AUDIO "English" of group "aac"`) {
+		t.Errorf("Exit code %d, output:\n%s", code, out)
+	}
+	code, out, _ = runCommand(t, "", "info", "../../sample-playlists/media-playlist-with-byterange.m3u8")
+	if code != exitOK || !strings.Contains(out, "  segments: 3\n  total duration: 30.000\n") {
+		t.Errorf("Exit code %d, output:\n%s", code, out)
+	}
+}
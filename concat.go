@@ -0,0 +1,112 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines concatenation of media playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrIframeMismatch returned by Concat when I-frame only playlists
+	// are mixed with the regular ones.
+	ErrIframeMismatch = errors.New("I-frame only and regular playlists can't be mixed")
+	// ErrMapMismatch returned by Concat when segments without media
+	// initialization section follow the segments with EXT-X-MAP. The
+	// map can't be cancelled so the player would apply it to them.
+	ErrMapMismatch = errors.New("segments without EXT-X-MAP can't follow segments with it")
+)
+
+// Concat concatenates the media playlists into a new VOD playlist, for
+// example pre-roll, main content and post-roll. EXT-X-DISCONTINUITY
+// is put on the first segment of each next playlist. The keys and maps
+// in effect, including the default ones of the playlists, are carried
+// over as EXT-X-KEY and EXT-X-MAP of the segments where they change;
+// the encryption is turned off by METHOD=NONE when an encrypted
+// playlist is followed by not encrypted one. Segments are renumbered
+// from zero, target duration and version are computed from them.
+// Segments are copied so the playlists stay unchanged but the keys,
+// maps and custom tags are shared with them. The playlist level custom
+// tags and Widevine parameters are not carried.
+func Concat(playlists ...*MediaPlaylist) (*MediaPlaylist, error) {
+	if len(playlists) == 0 {
+		return nil, errors.New("no playlists to concatenate")
+	}
+	var total uint
+	for i, p := range playlists {
+		if p.Iframe != playlists[0].Iframe {
+			return nil, fmt.Errorf("playlist %d: %w", i, ErrIframeMismatch)
+		}
+		total += p.count
+	}
+	if total == 0 {
+		total = 1 // NewMediaPlaylist requires capacity
+	}
+	result, err := NewMediaPlaylist(0, total)
+	if err != nil {
+		return nil, err
+	}
+	result.Iframe = playlists[0].Iframe
+	result.TargetDuration = 0
+
+	var (
+		key   *Key // in effect for the last added segment, nil if not encrypted
+		m     *Map
+		first = true
+	)
+	for i, p := range playlists {
+		pkey, pmap := p.Key, p.Map
+		boundary := !first
+		for _, seg := range p.segments() {
+			if seg.Key != nil {
+				pkey = seg.Key
+			}
+			if seg.Map != nil {
+				pmap = seg.Map
+			}
+			s := *seg
+			if !equalPointers(encryptionKey(pkey), key) {
+				s.Key = pkey
+				if pkey == nil {
+					s.Key = &Key{Method: "NONE"}
+				}
+			}
+			if !equalPointers(pmap, m) {
+				if pmap == nil {
+					return nil, fmt.Errorf("playlist %d: %w", i, ErrMapMismatch)
+				}
+				s.Map = pmap
+			}
+			if boundary && s.Discontinuity == nil {
+				s.Discontinuity = new(float64)
+			}
+			if err = result.AppendSegment(&s); err != nil {
+				return nil, err
+			}
+			key, m = encryptionKey(pkey), pmap
+			boundary, first = false, false
+		}
+	}
+	result.Close()
+	result.MediaType = VOD
+	result.ver = result.RequiredVersion()
+	return result, nil
+}
+
+// encryptionKey returns the key or nil if the key turns the encryption
+// off.
+func encryptionKey(key *Key) *Key {
+	if key != nil && key.Method == "NONE" {
+		return nil
+	}
+	return key
+}
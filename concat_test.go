@@ -0,0 +1,93 @@
+/*
+Playlist concatenation tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	preroll := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:5\n#EXT-X-MAP:URI=\"ad-init.mp4\"\n#EXTINF:4.5,\nad0.m4s\n#EXTINF:4,\nad1.m4s\n#EXT-X-ENDLIST\n")
+	main := decodeMedia(t, `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXTINF:9.6,
+main0.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="k2"
+#EXTINF:10,
+main1.m4s
+#EXT-X-ENDLIST
+`)
+	main.SetDefaultKey("AES-128", "k1", "", "", "")
+	postroll := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:5\n#EXT-X-MAP:URI=\"ad-init.mp4\"\n#EXTINF:5,\nad2.m4s\n#EXT-X-ENDLIST\n")
+
+	result, err := Concat(preroll, main, postroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-TARGETDURATION:10
+#EXT-X-MAP:URI="ad-init.mp4"
+#EXTINF:4.500,
+ad0.m4s
+#EXTINF:4.000,
+ad1.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:9.600,
+main0.m4s
+#EXT-X-KEY:METHOD=AES-128,URI="k2"
+#EXTINF:10.000,
+main1.m4s
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="ad-init.mp4"
+#EXTINF:5.000,
+ad2.m4s
+#EXT-X-ENDLIST
+`
+	if result.String() != expected {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", result, expected)
+	}
+	if segs := result.segments(); segs[4].SeqId != 4 || segs[2].Discontinuity == nil {
+		t.Errorf("Segments are not renumbered: %+v", segs)
+	}
+	if main.Segments[0].Discontinuity != nil || main.Segments[0].SeqId != 100 {
+		t.Error("Source playlist is changed")
+	}
+
+	iframes, err := NewMediaPlaylist(0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iframes.SetIframeOnly()
+	if _, err = Concat(main, iframes); !errors.Is(err, ErrIframeMismatch) {
+		t.Errorf("Got error %v, expected %v", err, ErrIframeMismatch)
+	}
+
+	ts := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXTINF:6,\na.ts\n#EXT-X-ENDLIST\n")
+	if _, err = Concat(main, ts); !errors.Is(err, ErrMapMismatch) {
+		t.Errorf("Got error %v, expected %v", err, ErrMapMismatch)
+	}
+	// media initialization section may start after the segments without it
+	if _, err = Concat(ts, main); err != nil {
+		t.Errorf("Got error %v for TS followed by fMP4", err)
+	}
+	if _, err = Concat(); err == nil {
+		t.Error("No error for no playlists")
+	}
+}
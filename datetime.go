@@ -0,0 +1,103 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines the program date time of media segments.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"sort"
+	"time"
+)
+
+// ProgramDateTimes returns the effective program date time of each
+// segment in the order they were added. EXT-X-PROGRAM-DATE-TIME is
+// usually set only for some segments so the time of the others is
+// interpolated: forward from the last tagged segment before them by
+// adding the durations of the segments in between, or backward from
+// the first tagged segment after them when there is no such one.
+// The timestamps don't flow over EXT-X-DISCONTINUITY so the
+// interpolation starts anew after it. The time is zero for the
+// segments without any tagged segment in the same discontinuity.
+func (p *MediaPlaylist) ProgramDateTimes() []time.Time {
+	return programDateTimes(p.segments())
+}
+
+// programDateTimes interpolates the program date time of the
+// segments between discontinuities.
+func programDateTimes(segments []*MediaSegment) []time.Time {
+	pdts := make([]time.Time, len(segments))
+	for start := 0; start < len(segments); {
+		end := start + 1
+		for end < len(segments) && segments[end].Discontinuity == nil {
+			end++
+		}
+		interpolateDateTimes(segments[start:end], pdts[start:end])
+		start = end
+	}
+	return pdts
+}
+
+// interpolateDateTimes sets the program date time of the continuous
+// segments.
+func interpolateDateTimes(segments []*MediaSegment, pdts []time.Time) {
+	var (
+		anchor  time.Time
+		elapsed float64 // since the anchor, summed in seconds to not accumulate rounding
+		first   = -1    // the first tagged segment
+	)
+	for i, seg := range segments {
+		if !seg.ProgramDateTime.IsZero() {
+			anchor, elapsed = seg.ProgramDateTime, 0
+			if first < 0 {
+				first = i
+			}
+		}
+		if !anchor.IsZero() {
+			pdts[i] = anchor.Add(seconds(elapsed))
+		}
+		elapsed += seg.Duration
+	}
+	var before float64
+	for i := first - 1; i >= 0; i-- {
+		before += segments[i].Duration
+		pdts[i] = segments[first].ProgramDateTime.Add(-seconds(before))
+	}
+}
+
+// TimeAt returns the wall-clock time at the offset from the start of
+// the segment. The result is false when the program date time of the
+// segment is unknown.
+func (s TimelineSegment) TimeAt(offset time.Duration) (time.Time, bool) {
+	if s.ProgramDateTime.IsZero() {
+		return time.Time{}, false
+	}
+	return s.ProgramDateTime.Add(offset), true
+}
+
+// SegmentAtTime returns the segment playing at the wall-clock time and
+// the offset of the time from the start of the segment. The program
+// date time is expected to grow along the playlist as it does for the
+// live and DVR playlists. The result is false when the time falls out
+// of the segments with known program date time, for example into a
+// gap between discontinuities.
+func (t *Timeline) SegmentAtTime(at time.Time) (TimelineSegment, time.Duration, bool) {
+	i := sort.Search(len(t.dated), func(i int) bool {
+		seg := t.segments[t.dated[i]]
+		return seg.ProgramDateTime.Add(seg.End - seg.Start).After(at)
+	})
+	if i == len(t.dated) {
+		return TimelineSegment{}, 0, false
+	}
+	seg := t.segments[t.dated[i]]
+	if at.Before(seg.ProgramDateTime) {
+		return TimelineSegment{}, 0, false
+	}
+	return seg, at.Sub(seg.ProgramDateTime), true
+}
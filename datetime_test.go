@@ -0,0 +1,116 @@
+/*
+Program date time tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"testing"
+	"time"
+)
+
+const datedPlaylist = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:1
+#EXTINF:10,
+s1.ts
+#EXTINF:10,
+s2.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00Z
+#EXTINF:10,
+s3.ts
+#EXTINF:10,
+s4.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:21Z
+#EXTINF:10,
+s5.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:6,
+s6.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:6,
+s7.ts
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T11:00:00Z
+#EXTINF:6,
+s8.ts
+`
+
+func TestProgramDateTimes(t *testing.T) {
+	p := decodeMedia(t, datedPlaylist)
+	base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	expected := []time.Time{
+		base.Add(-20 * time.Second), // backward from s3
+		base.Add(-10 * time.Second),
+		base,
+		base.Add(10 * time.Second),
+		base.Add(21 * time.Second), // the tag wins over interpolation
+		{},                         // no tagged segments up to the next discontinuity
+		base.Add(time.Hour - 6*time.Second),
+		base.Add(time.Hour),
+	}
+	pdts := p.ProgramDateTimes()
+	if len(pdts) != len(expected) {
+		t.Fatalf("Got %d times, expected %d", len(pdts), len(expected))
+	}
+	for i := range expected {
+		if !pdts[i].Equal(expected[i]) {
+			t.Errorf("Segment %d: got time %v, expected %v", i+1, pdts[i], expected[i])
+		}
+	}
+	if p.Segments[0].ProgramDateTime != (time.Time{}) {
+		t.Error("Source playlist is changed")
+	}
+}
+
+func TestTimelineWallClock(t *testing.T) {
+	tl := NewTimeline(decodeMedia(t, datedPlaylist))
+	base := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		at     time.Time
+		uri    string
+		offset time.Duration
+	}{
+		{base.Add(-20 * time.Second), "s1.ts", 0},
+		{base.Add(15 * time.Second), "s4.ts", 5 * time.Second},
+		{base.Add(30 * time.Second), "s5.ts", 9 * time.Second},
+		{base.Add(time.Hour + time.Second), "s8.ts", time.Second},
+	} {
+		seg, offset, ok := tl.SegmentAtTime(c.at)
+		if !ok || seg.Segment.URI != c.uri || offset != c.offset {
+			t.Errorf("Got segment %+v at %v, %v for %v", seg, offset, ok, c.at)
+			continue
+		}
+		if at, ok := seg.TimeAt(offset); !ok || !at.Equal(c.at) {
+			t.Errorf("Got time %v, %v, expected %v", at, ok, c.at)
+		}
+	}
+	for _, at := range []time.Time{
+		base.Add(-time.Minute),
+		base.Add(20500 * time.Millisecond), // gap up to the next tag
+		base.Add(31 * time.Second),         // gap before the discontinuities
+		base.Add(2 * time.Hour),
+	} {
+		if seg, _, ok := tl.SegmentAtTime(at); ok {
+			t.Errorf("Got segment %+v for %v", seg, at)
+		}
+	}
+	if seg, _ := tl.SegmentBySeqID(6); !seg.ProgramDateTime.IsZero() {
+		t.Errorf("Got time %v for the segment without anchor", seg.ProgramDateTime)
+	} else if _, ok := seg.TimeAt(0); ok {
+		t.Error("Got time for the segment without anchor")
+	}
+
+	// the segments before the first tag are clipped by the interpolated time
+	clip, err := decodeMedia(t, datedPlaylist).ClipTime(base.Add(-15*time.Second), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if segs := clip.segments(); len(segs) != 2 || segs[0].URI != "s1.ts" || clip.StartTime != 5 || !segs[0].ProgramDateTime.Equal(base.Add(-20*time.Second)) {
+		t.Errorf("Got playlist\n%s", clip)
+	}
+}
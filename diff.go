@@ -0,0 +1,452 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines semantic comparison of playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is the kind of the change found by Diff.
+type ChangeKind int
+
+const (
+	ChangeAdded ChangeKind = iota
+	ChangeRemoved
+	ChangeModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case ChangeAdded:
+		return "added"
+	case ChangeRemoved:
+		return "removed"
+	case ChangeModified:
+		return "modified"
+	}
+	return fmt.Sprintf("change(%d)", int(k))
+}
+
+// Subjects of the changes found by Diff.
+const (
+	SubjectVariant               = "variant"                // EXT-X-STREAM-INF or EXT-X-I-FRAME-STREAM-INF
+	SubjectRendition             = "rendition"              // EXT-X-MEDIA
+	SubjectSegment               = "segment"                // media segment
+	SubjectKey                   = "key"                    // EXT-X-KEY in effect for the segment
+	SubjectMap                   = "map"                    // EXT-X-MAP in effect for the segment
+	SubjectTargetDuration        = "target-duration"        // EXT-X-TARGETDURATION
+	SubjectDiscontinuitySequence = "discontinuity-sequence" // EXT-X-DISCONTINUITY-SEQUENCE
+)
+
+// Change is the difference found by Diff. ID identifies the changed
+// object: STABLE-VARIANT-ID or URI of variants, TYPE/GROUP-ID/NAME of
+// renditions and media sequence number of segments. Old and New are
+// the compared values: *Variant, *Alternative, *MediaSegment, *Key,
+// *Map, float64 target duration or uint64 discontinuity sequence.
+// Old is nil for the added objects and New is nil for the removed
+// ones.
+type Change struct {
+	Kind    ChangeKind
+	Subject string
+	ID      string
+	Old     interface{}
+	New     interface{}
+	Message string
+}
+
+func (c Change) String() string {
+	return c.Subject + " " + c.Kind.String() + ": " + c.Message
+}
+
+// Diff compares the master playlist with the newer one and returns
+// the changes of variants and renditions. Variants are matched by
+// STABLE-VARIANT-ID when they have it and by URI otherwise. It returns
+// nil when the playlists are the same.
+func (p *MasterPlaylist) Diff(newer *MasterPlaylist) []Change {
+	var changes []Change
+	add := func(kind ChangeKind, subject, id string, old, new interface{}, format string, args ...interface{}) {
+		changes = append(changes, Change{kind, subject, id, old, new, fmt.Sprintf(format, args...)})
+	}
+
+	// variants with the same identity are matched in their order
+	type variantKey struct {
+		iframe bool
+		id     string
+	}
+	newVariants := make(map[variantKey][]*Variant)
+	for _, v := range newer.Variants {
+		if v != nil {
+			key := variantKey{v.Iframe, variantID(v)}
+			newVariants[key] = append(newVariants[key], v)
+		}
+	}
+	matched := make(map[*Variant]bool)
+	for _, v := range p.Variants {
+		if v == nil {
+			continue
+		}
+		id := variantID(v)
+		key := variantKey{v.Iframe, id}
+		candidates := newVariants[key]
+		if len(candidates) == 0 {
+			add(ChangeRemoved, SubjectVariant, id, v, nil, "%s of %s removed", variantTag(v), id)
+			continue
+		}
+		nv := candidates[0]
+		newVariants[key] = candidates[1:]
+		matched[nv] = true
+		if diff := diffAttributes(variantAttributes(v), variantAttributes(nv)); diff != "" {
+			add(ChangeModified, SubjectVariant, id, v, nv, "%s of %s: %s", variantTag(v), id, diff)
+		}
+	}
+	for _, v := range newer.Variants {
+		if v != nil && !matched[v] {
+			id := variantID(v)
+			add(ChangeAdded, SubjectVariant, id, nil, v, "%s of %s added", variantTag(v), id)
+		}
+	}
+
+	oldRenditions, oldOrder := renditionsOf(p)
+	newRenditions, newOrder := renditionsOf(newer)
+	for _, id := range oldOrder {
+		alt, nalt := oldRenditions[id], newRenditions[id]
+		if nalt == nil {
+			add(ChangeRemoved, SubjectRendition, id, alt, nil, "%s removed", id)
+			continue
+		}
+		if diff := diffAttributes(renditionAttributes(alt), renditionAttributes(nalt)); diff != "" {
+			add(ChangeModified, SubjectRendition, id, alt, nalt, "%s: %s", id, diff)
+		}
+	}
+	for _, id := range newOrder {
+		if oldRenditions[id] == nil {
+			add(ChangeAdded, SubjectRendition, id, nil, newRenditions[id], "%s added", id)
+		}
+	}
+	return changes
+}
+
+// Diff compares the media playlist with the newer one, usually the
+// reloaded live playlist, and returns the changes of the target
+// duration, the discontinuity sequence, the segments matched by media
+// sequence numbers and the keys and maps in effect for them. All the
+// segments of the playlists are compared regardless of the windows.
+// It returns nil when the playlists are the same.
+func (p *MediaPlaylist) Diff(newer *MediaPlaylist) []Change {
+	var changes []Change
+	add := func(kind ChangeKind, subject, id string, old, new interface{}, format string, args ...interface{}) {
+		changes = append(changes, Change{kind, subject, id, old, new, fmt.Sprintf(format, args...)})
+	}
+
+	if p.TargetDuration != newer.TargetDuration {
+		add(ChangeModified, SubjectTargetDuration, "", p.TargetDuration, newer.TargetDuration,
+			"target duration changed from %v to %v", p.TargetDuration, newer.TargetDuration)
+	}
+
+	oldSegments, newSegments := p.segments(), newer.segments()
+	oldIndex := make(map[uint64]int, len(oldSegments))
+	for i, seg := range oldSegments {
+		oldIndex[seg.SeqId] = i
+	}
+	newBySeq := make(map[uint64]*MediaSegment, len(newSegments))
+	for _, seg := range newSegments {
+		newBySeq[seg.SeqId] = seg
+	}
+
+	// the discontinuity sequence grows by the discontinuities which
+	// expired from the playlist
+	expected := p.DiscontinuitySeq
+	for _, seg := range oldSegments {
+		if newBySeq[seg.SeqId] == nil && len(newSegments) > 0 && seg.SeqId < newSegments[0].SeqId && seg.Discontinuity != nil {
+			expected++
+		}
+	}
+	if newer.DiscontinuitySeq != p.DiscontinuitySeq {
+		if newer.DiscontinuitySeq == expected {
+			add(ChangeModified, SubjectDiscontinuitySequence, "", p.DiscontinuitySeq, newer.DiscontinuitySeq,
+				"discontinuity sequence changed from %d to %d", p.DiscontinuitySeq, newer.DiscontinuitySeq)
+		} else {
+			add(ChangeModified, SubjectDiscontinuitySequence, "", p.DiscontinuitySeq, newer.DiscontinuitySeq,
+				"discontinuity sequence jumped from %d to %d, expected %d for the expired segments", p.DiscontinuitySeq, newer.DiscontinuitySeq, expected)
+		}
+	} else if newer.DiscontinuitySeq != expected {
+		add(ChangeModified, SubjectDiscontinuitySequence, "", p.DiscontinuitySeq, newer.DiscontinuitySeq,
+			"discontinuity sequence stays %d, expected %d for the expired segments", p.DiscontinuitySeq, expected)
+	}
+
+	for _, seg := range oldSegments {
+		if _, ok := newBySeq[seg.SeqId]; ok {
+			continue
+		}
+		id := strconv.FormatUint(seg.SeqId, 10)
+		if len(newSegments) > 0 && seg.SeqId < newSegments[0].SeqId {
+			add(ChangeRemoved, SubjectSegment, id, seg, nil, "segment %d %s expired", seg.SeqId, seg.URI)
+		} else {
+			add(ChangeRemoved, SubjectSegment, id, seg, nil, "segment %d %s removed", seg.SeqId, seg.URI)
+		}
+	}
+
+	oldKeys, oldMaps := effectiveKeys(p, oldSegments), effectiveMaps(p, oldSegments)
+	newKeys, newMaps := effectiveKeys(newer, newSegments), effectiveMaps(newer, newSegments)
+	// the state before the first segment of the newer playlist is the
+	// state after the last segment of the playlist
+	prevKey, prevMap := p.Key, p.Map
+	if len(oldSegments) > 0 {
+		prevKey, prevMap = oldKeys[len(oldKeys)-1], oldMaps[len(oldMaps)-1]
+	}
+	var keyRun changeRun[Key]
+	var mapRun changeRun[Map]
+	for i, seg := range newSegments {
+		id := strconv.FormatUint(seg.SeqId, 10)
+		j, common := oldIndex[seg.SeqId]
+		switch {
+		case common:
+			old := oldSegments[j]
+			if diff := diffAttributes(segmentAttributes(old), segmentAttributes(seg)); diff != "" {
+				add(ChangeModified, SubjectSegment, id, old, seg, "segment %d: %s", seg.SeqId, diff)
+			}
+		case len(oldSegments) > 0 && seg.SeqId > oldSegments[len(oldSegments)-1].SeqId:
+			add(ChangeAdded, SubjectSegment, id, nil, seg, "segment %d %s appended", seg.SeqId, seg.URI)
+		default:
+			add(ChangeAdded, SubjectSegment, id, nil, seg, "segment %d %s added", seg.SeqId, seg.URI)
+		}
+
+		// common segments are compared with themselves, others with
+		// the previous segment so each transition is reported once
+		baseKey, baseMap := prevKey, prevMap
+		if common {
+			baseKey, baseMap = oldKeys[j], oldMaps[j]
+		} else if i > 0 {
+			baseKey, baseMap = newKeys[i-1], newMaps[i-1]
+		}
+		if keyRun.starts(baseKey, newKeys[i], common) {
+			add(pointerChange(baseKey, newKeys[i]), SubjectKey, id, baseKey, newKeys[i], "segment %d key %s", seg.SeqId, describeKey(baseKey, newKeys[i]))
+		}
+		if mapRun.starts(baseMap, newMaps[i], common) {
+			add(pointerChange(baseMap, newMaps[i]), SubjectMap, id, baseMap, newMaps[i], "segment %d map %s", seg.SeqId, describeMap(baseMap, newMaps[i]))
+		}
+	}
+	return changes
+}
+
+// variantID returns the identity of the variant for Diff.
+func variantID(v *Variant) string {
+	if v.StableVariantId != "" {
+		return v.StableVariantId
+	}
+	return v.URI
+}
+
+func variantTag(v *Variant) string {
+	if v.Iframe {
+		return "EXT-X-I-FRAME-STREAM-INF"
+	}
+	return "EXT-X-STREAM-INF"
+}
+
+// attribute is the named value compared by Diff.
+type attribute struct {
+	name  string
+	value string
+}
+
+func variantAttributes(v *Variant) []attribute {
+	return []attribute{
+		{"URI", v.URI},
+		{"PROGRAM-ID", formatUint(uint64(v.ProgramId))},
+		{"BANDWIDTH", formatUint(uint64(v.Bandwidth))},
+		{"AVERAGE-BANDWIDTH", formatUint(uint64(v.AverageBandwidth))},
+		{"CODECS", v.Codecs},
+		{"RESOLUTION", v.Resolution},
+		{"FRAME-RATE", formatFloat(v.FrameRate)},
+		{"AUDIO", v.Audio},
+		{"VIDEO", v.Video},
+		{"SUBTITLES", v.Subtitles},
+		{"CLOSED-CAPTIONS", v.Captions},
+		{"NAME", v.Name},
+		{"VIDEO-RANGE", v.VideoRange},
+		{"HDCP-LEVEL", v.HDCPLevel},
+		{"STABLE-VARIANT-ID", v.StableVariantId},
+	}
+}
+
+func renditionAttributes(alt *Alternative) []attribute {
+	return []attribute{
+		{"URI", alt.URI},
+		{"LANGUAGE", alt.Language},
+		{"DEFAULT", strconv.FormatBool(alt.Default)},
+		{"AUTOSELECT", alt.Autoselect},
+		{"FORCED", alt.Forced},
+		{"CHARACTERISTICS", alt.Characteristics},
+		{"SUBTITLES", alt.Subtitles},
+	}
+}
+
+func segmentAttributes(seg *MediaSegment) []attribute {
+	attrs := []attribute{
+		{"URI", seg.URI},
+		{"DURATION", formatFloat(seg.Duration)},
+		{"BYTERANGE", ""},
+		{"DISCONTINUITY", strconv.FormatBool(seg.Discontinuity != nil)},
+		{"PROGRAM-DATE-TIME", ""},
+	}
+	if seg.Limit > 0 {
+		attrs[2].value = strconv.FormatInt(seg.Limit, 10) + "@" + strconv.FormatInt(seg.Offset, 10)
+	}
+	if !seg.ProgramDateTime.IsZero() {
+		attrs[4].value = seg.ProgramDateTime.Format(DATETIME)
+	}
+	return attrs
+}
+
+// diffAttributes describes the attributes which differ or returns
+// empty string.
+func diffAttributes(old, new []attribute) string {
+	var diffs []string
+	for i := range old {
+		if old[i].value != new[i].value {
+			diffs = append(diffs, fmt.Sprintf("%s changed from %q to %q", old[i].name, old[i].value, new[i].value))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func formatUint(v uint64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func formatFloat(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// renditionsOf returns the renditions of the master playlist by
+// TYPE/GROUP-ID/NAME which identifies them within the playlist.
+func renditionsOf(p *MasterPlaylist) (map[string]*Alternative, []string) {
+	renditions := make(map[string]*Alternative)
+	var order []string
+	for _, v := range p.Variants {
+		if v == nil {
+			continue
+		}
+		for _, alt := range v.Alternatives {
+			if alt == nil {
+				continue
+			}
+			id := alt.Type + "/" + alt.GroupId + "/" + alt.Name
+			if _, ok := renditions[id]; !ok {
+				renditions[id] = alt
+				order = append(order, id)
+			}
+		}
+	}
+	return renditions, order
+}
+
+// effectiveKeys returns the key in effect for each of the segments.
+func effectiveKeys(p *MediaPlaylist, segments []*MediaSegment) []*Key {
+	keys := make([]*Key, len(segments))
+	key := p.Key
+	for i, seg := range segments {
+		if seg.Key != nil {
+			key = seg.Key
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+// effectiveMaps returns the map in effect for each of the segments.
+func effectiveMaps(p *MediaPlaylist, segments []*MediaSegment) []*Map {
+	maps := make([]*Map, len(segments))
+	m := p.Map
+	for i, seg := range segments {
+		if seg.Map != nil {
+			m = seg.Map
+		}
+		maps[i] = m
+	}
+	return maps
+}
+
+// changeRun tracks the change of the key or the map in effect for
+// the consecutive segments.
+type changeRun[T comparable] struct {
+	open      bool
+	base, cur *T
+}
+
+// starts reports whether the change from base to cur starts at the
+// segment. The same change for the consecutive common segments is
+// reported once.
+func (r *changeRun[T]) starts(base, cur *T, common bool) bool {
+	if equalPointers(base, cur) {
+		r.open = false
+		return false
+	}
+	if common && r.open && equalPointers(r.base, base) && equalPointers(r.cur, cur) {
+		return false
+	}
+	r.open, r.base, r.cur = common, base, cur
+	return true
+}
+
+// equalPointers compares the values pointed to.
+func equalPointers[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func pointerChange[T any](old, new *T) ChangeKind {
+	switch {
+	case old == nil:
+		return ChangeAdded
+	case new == nil:
+		return ChangeRemoved
+	}
+	return ChangeModified
+}
+
+func describeKey(old, new *Key) string {
+	format := func(k *Key) string {
+		if k == nil {
+			return "none"
+		}
+		if k.URI == "" {
+			return k.Method
+		}
+		return k.Method + " " + k.URI
+	}
+	return "changed from " + format(old) + " to " + format(new)
+}
+
+func describeMap(old, new *Map) string {
+	format := func(m *Map) string {
+		if m == nil {
+			return "none"
+		}
+		if m.Limit > 0 {
+			return m.URI + " " + strconv.FormatInt(m.Limit, 10) + "@" + strconv.FormatInt(m.Offset, 10)
+		}
+		return m.URI
+	}
+	return "changed from " + format(old) + " to " + format(new)
+}
@@ -0,0 +1,172 @@
+/*
+Playlist comparison tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"strings"
+	"testing"
+)
+
+// changes returns the changes as "subject kind id" strings.
+func changes(list []Change) []string {
+	var out []string
+	for _, c := range list {
+		out = append(out, c.Subject+" "+c.Kind.String()+" "+c.ID)
+	}
+	return out
+}
+
+func decodeMedia(t *testing.T, src string) *MediaPlaylist {
+	t.Helper()
+	p, err := NewMediaPlaylist(0, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.DecodeFrom(strings.NewReader(src), true); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMediaPlaylistDiff(t *testing.T) {
+	old := decodeMedia(t, `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXT-X-DISCONTINUITY
+#EXTINF:6,
+a.ts
+#EXTINF:6,
+b.ts
+#EXTINF:6,
+c.ts
+`)
+	newer := decodeMedia(t, `#EXTM3U
+#EXT-X-TARGETDURATION:8
+#EXT-X-MEDIA-SEQUENCE:11
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXT-X-KEY:METHOD=AES-128,URI="k1"
+#EXTINF:6,
+b.ts
+#EXTINF:5,
+c.ts
+#EXT-X-KEY:METHOD=AES-128,URI="k2"
+#EXTINF:6,
+d.ts
+#EXTINF:6,
+e.ts
+`)
+	diff := old.Diff(newer)
+	expected := []string{
+		"target-duration modified ",
+		"discontinuity-sequence modified ",
+		"segment removed 10",
+		"segment modified 12",
+		"segment added 13",
+		"key modified 13",
+		"segment added 14",
+	}
+	if got := changes(diff); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Got changes\n%v\nexpected\n%v", got, expected)
+	}
+	for i, message := range map[int]string{
+		1: "discontinuity sequence changed from 0 to 1",
+		2: "segment 10 a.ts expired",
+		3: `segment 12: DURATION changed from "6" to "5"`,
+		4: "segment 13 d.ts appended",
+		5: "segment 13 key changed from AES-128 k1 to AES-128 k2",
+	} {
+		if diff[i].Message != message {
+			t.Errorf("Got message %q, expected %q", diff[i].Message, message)
+		}
+	}
+	if k := diff[5].New.(*Key); k.URI != "k2" {
+		t.Errorf("Got new key %+v", k)
+	}
+
+	if diff := newer.Diff(newer); diff != nil {
+		t.Errorf("Got changes %v for the same playlist", changes(diff))
+	}
+
+	// the discontinuity sequence doesn't follow the expired segments
+	jumped := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:11\n#EXT-X-DISCONTINUITY-SEQUENCE:5\n#EXT-X-KEY:METHOD=AES-128,URI=\"k1\"\n#EXTINF:6,\nb.ts\n#EXTINF:6,\nc.ts\n")
+	diff = old.Diff(jumped)
+	if len(diff) != 2 || diff[0].Message != "discontinuity sequence jumped from 0 to 5, expected 1 for the expired segments" {
+		t.Errorf("Got changes %v", diff)
+	}
+
+	// the changed default key is reported once for the common segments
+	rekeyed := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:10\n#EXT-X-KEY:METHOD=NONE\n#EXT-X-DISCONTINUITY\n#EXTINF:6,\na.ts\n#EXTINF:6,\nb.ts\n#EXTINF:6,\nc.ts\n")
+	if got := changes(old.Diff(rekeyed)); strings.Join(got, "|") != "key modified 10" {
+		t.Errorf("Got changes %v", got)
+	}
+}
+
+func TestMasterPlaylistDiff(t *testing.T) {
+	decode := func(src string) *MasterPlaylist {
+		p := NewMasterPlaylist()
+		if err := p.DecodeFrom(strings.NewReader(src), true); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	old := decode(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="German",LANGUAGE="de",URI="de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,AUDIO="aac",STABLE-VARIANT-ID="low"
+low/v1.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2000000,AUDIO="aac"
+mid.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=4000000,AUDIO="aac"
+high.m3u8
+`)
+	newer := decode(`#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",URI="en2.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="French",LANGUAGE="fr",URI="fr.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,AUDIO="aac",STABLE-VARIANT-ID="low"
+low/v2.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,AUDIO="aac"
+mid.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=8000000,AUDIO="aac"
+top.m3u8
+`)
+	diff := old.Diff(newer)
+	expected := []string{
+		"variant modified low",
+		"variant modified mid.m3u8",
+		"variant removed high.m3u8",
+		"variant added top.m3u8",
+		"rendition modified AUDIO/aac/English",
+		"rendition removed AUDIO/aac/German",
+		"rendition added AUDIO/aac/French",
+	}
+	if got := changes(diff); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Fatalf("Got changes\n%v\nexpected\n%v", got, expected)
+	}
+	if message := `EXT-X-STREAM-INF of low: URI changed from "low/v1.m3u8" to "low/v2.m3u8"`; diff[0].Message != message {
+		t.Errorf("Got message %q, expected %q", diff[0].Message, message)
+	}
+	if message := `EXT-X-STREAM-INF of mid.m3u8: BANDWIDTH changed from "2000000" to "2500000"`; diff[1].Message != message {
+		t.Errorf("Got message %q, expected %q", diff[1].Message, message)
+	}
+	if !strings.Contains(newer.String(), `STABLE-VARIANT-ID="low"`) {
+		t.Errorf("STABLE-VARIANT-ID is not encoded:\n%s", newer)
+	}
+	if diff := newer.Diff(newer); diff != nil {
+		t.Errorf("Got changes %v for the same playlist", changes(diff))
+	}
+
+	subtitled := decode(newer.String())
+	subtitled.Variants[0].Alternatives[0].Subtitles = "subs"
+	diff = newer.Diff(subtitled)
+	if got := changes(diff); len(got) != 1 || got[0] != "rendition modified AUDIO/aac/English" || !strings.Contains(diff[0].Message, "SUBTITLES") {
+		t.Errorf("Got changes %v for the changed SUBTITLES", got)
+	}
+}
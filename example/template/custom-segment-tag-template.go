@@ -2,7 +2,7 @@ package template
 
 import (
 	"bytes"
-	"errors"
+	"strings"
 
 	"github.com/135yshr/m3u8"
 )
@@ -25,26 +25,18 @@ func (tag *CustomSegmentTag) TagName() string {
 // Decode decodes the input string to the internal structure. The line
 // will be the entire matched line, including the identifier.
 func (tag *CustomSegmentTag) Decode(line string) (m3u8.CustomTag, error) {
-	var err error
-
 	// Since this is a Segment tag, we want to create a new tag every time it is decoded
 	// as there can be one for each segment with
 	newTag := new(CustomSegmentTag)
 
-	for k, v := range m3u8.DecodeAttributeList(line[20:]) {
-		switch k {
-		case "NAME":
-			newTag.Name = v
-		case "JEDI":
-			if v == "YES" {
-				newTag.Jedi = true
-			} else if v == "NO" {
-				newTag.Jedi = false
-			} else {
-				err = errors.New("Valid strings for JEDI attribute are YES and NO.")
-			}
-		}
+	attrs, err := m3u8.ParseAttributeList(strings.TrimPrefix(line, tag.TagName()))
+	if err != nil {
+		return newTag, err
+	}
+	if newTag.Name, err = attrs.QuotedString("NAME"); err != nil {
+		return newTag, err
 	}
+	newTag.Jedi, err = attrs.Bool("JEDI")
 
 	return newTag, err
 }
@@ -60,14 +52,9 @@ func (tag *CustomSegmentTag) Encode() *bytes.Buffer {
 
 	if tag.Name != "" {
 		buf.WriteString(tag.TagName())
-		buf.WriteString("NAME=\"")
-		buf.WriteString(tag.Name)
-		buf.WriteString("\",JEDI=")
-		if tag.Jedi {
-			buf.WriteString("YES")
-		} else {
-			buf.WriteString("NO")
-		}
+		w := m3u8.NewAttributeWriter(buf)
+		w.QuotedString("NAME", tag.Name)
+		w.Bool("JEDI", tag.Jedi)
 	}
 
 	return buf
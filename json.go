@@ -0,0 +1,926 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines JSON representation of playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JSONSchemaVersion is the version of JSON schema written by
+// MarshalJSON of the playlists. UnmarshalJSON accepts this and all
+// the previous versions. Playlist objects without "schema" member are
+// read as the current version.
+//
+// The schema of version 1. Members with zero values are omitted
+// unless noted otherwise.
+//
+//	master playlist:
+//	  "schema"                 number, always written
+//	  "version"                number, EXT-X-VERSION
+//	  "independentSegments"    bool, EXT-X-INDEPENDENT-SEGMENTS
+//	  "args"                   string
+//	  "cypherVersion"          string
+//	  "renditions"             array of renditions shared by the variants
+//	  "variants"               array of variants, always written
+//	  "custom"                 array of custom tags
+//	  "encoder"                encoder options set by SetEncoderOptions
+//
+//	media playlist:
+//	  "schema"                 number, always written
+//	  "version"                number, EXT-X-VERSION
+//	  "targetDuration"         number, always written
+//	  "mediaSequence"          number, always written
+//	  "discontinuitySequence"  number
+//	  "playlistType"           "EVENT" or "VOD"
+//	  "iframesOnly"            bool
+//	  "closed"                 bool
+//	  "startTime"              number, EXT-X-START
+//	  "startTimePrecise"       bool
+//	  "args"                   string
+//	  "winSize"                number, always written
+//	  "capacity"               number, always written
+//	  "head"                   number, position of the first segment in the ring buffer, always written
+//	  "key"                    key, the default key
+//	  "map"                    map, the default map
+//	  "wv"                     Widevine parameters
+//	  "segments"               array of segments from the first to the last one, always written
+//	  "custom"                 array of custom tags
+//	  "encoder"                encoder options set by SetEncoderOptions
+//
+//	segment:
+//	  "seqId", "uri", "title", "duration", "limit", "offset",
+//	  "key", "map", "scte", "custom" as the fields of MediaSegment,
+//	  "discontinuity"          number, present if the segment has EXT-X-DISCONTINUITY
+//	  "defaultKey"             bool, the segment shares the default key of the playlist instead of "key"
+//	  "programDateTime"        string in RFC 3339 format
+//
+//	variant:
+//	  "uri", "chunklist" (media playlist), "programId", "bandwidth",
+//	  "averageBandwidth", "codecs", "resolution", "audio", "video",
+//	  "subtitles", "closedCaptions", "name", "iframe", "videoRange",
+//	  "hdcpLevel", "stableVariantId", "frameRate", "custom" as the
+//	  fields of Variant,
+//	  "renditions"             array of indexes in "renditions" of the master playlist
+//	  "alternatives"           array of renditions, used instead of "renditions" outside of the master playlist
+//
+//	rendition:
+//	  "groupId", "uri", "type", "language", "name", "default",
+//	  "autoselect", "forced", "characteristics", "subtitles",
+//	  "custom" as the fields of Alternative
+//
+//	key:   "method", "uri", "iv", "keyFormat", "keyFormatVersions"
+//	map:   "uri", "limit", "offset"
+//	scte:  "syntax" ("67-2014" or "oatcls"), "cueType" ("start", "mid"
+//	       or "end"), "cue", "id", "time", "elapsed"
+//	wv:    the fields of WV with the first letter in lower case
+//
+//	encoder options:
+//	  "durationPrecision", "durationAsInt", "pdtLayout", "pdtUTC",
+//	  "omitDeprecated", "crlf", "strict", "version" as the fields of
+//	  EncoderOptions
+//
+//	custom tag:
+//	  "tag"                    string, the name of the tag in the map of custom tags, always written
+//	  "line"                   string, the encoded tag
+//	  "value"                  JSON of the tag if it implements json.Marshaler
+//
+// The repeated custom tags are written as separate objects with the
+// same name.
+const JSONSchemaVersion = 1
+
+// JSONTagDecoder is the optional interface of custom decoders which
+// restore their tags from JSON values. The tags implementing
+// json.Marshaler are stored with their values and the decoder gets the
+// value back on UnmarshalJSON. Other decoders get the encoded line of
+// the tag. Tags without a matching decoder among the decoders set by
+// WithCustomDecoders or WithRegistry of the playlist are restored as
+// plain lines which encode the same way.
+type JSONTagDecoder interface {
+	DecodeJSON(value []byte) (CustomTag, error)
+}
+
+type jsonMasterPlaylist struct {
+	Schema              int                 `json:"schema"`
+	Version             uint8               `json:"version,omitempty"`
+	IndependentSegments bool                `json:"independentSegments,omitempty"`
+	Args                string              `json:"args,omitempty"`
+	CypherVersion       string              `json:"cypherVersion,omitempty"`
+	Renditions          []*jsonAlternative  `json:"renditions,omitempty"`
+	Variants            []*jsonVariant      `json:"variants"`
+	Custom              []jsonCustomTag     `json:"custom,omitempty"`
+	Encoder             *jsonEncoderOptions `json:"encoder,omitempty"`
+}
+
+type jsonMediaPlaylist struct {
+	Schema                int                 `json:"schema"`
+	Version               uint8               `json:"version,omitempty"`
+	TargetDuration        float64             `json:"targetDuration"`
+	MediaSequence         uint64              `json:"mediaSequence"`
+	DiscontinuitySequence uint64              `json:"discontinuitySequence,omitempty"`
+	PlaylistType          string              `json:"playlistType,omitempty"`
+	IframesOnly           bool                `json:"iframesOnly,omitempty"`
+	Closed                bool                `json:"closed,omitempty"`
+	StartTime             float64             `json:"startTime,omitempty"`
+	StartTimePrecise      bool                `json:"startTimePrecise,omitempty"`
+	Args                  string              `json:"args,omitempty"`
+	WinSize               uint                `json:"winSize"`
+	Capacity              uint                `json:"capacity"`
+	Head                  uint                `json:"head"`
+	Key                   *Key                `json:"key,omitempty"`
+	Map                   *Map                `json:"map,omitempty"`
+	WV                    *WV                 `json:"wv,omitempty"`
+	Segments              []*jsonMediaSegment `json:"segments"`
+	Custom                []jsonCustomTag     `json:"custom,omitempty"`
+	Encoder               *jsonEncoderOptions `json:"encoder,omitempty"`
+}
+
+type jsonMediaSegment struct {
+	SeqId           uint64          `json:"seqId"`
+	URI             string          `json:"uri"`
+	Title           string          `json:"title,omitempty"`
+	Duration        float64         `json:"duration"`
+	Limit           int64           `json:"limit,omitempty"`
+	Offset          int64           `json:"offset,omitempty"`
+	Key             *Key            `json:"key,omitempty"`
+	DefaultKey      bool            `json:"defaultKey,omitempty"`
+	Map             *Map            `json:"map,omitempty"`
+	Discontinuity   *float64        `json:"discontinuity,omitempty"`
+	SCTE            *SCTE           `json:"scte,omitempty"`
+	ProgramDateTime *time.Time      `json:"programDateTime,omitempty"`
+	Custom          []jsonCustomTag `json:"custom,omitempty"`
+}
+
+type jsonVariant struct {
+	URI              string             `json:"uri"`
+	Chunklist        *MediaPlaylist     `json:"chunklist,omitempty"`
+	ProgramId        uint32             `json:"programId,omitempty"`
+	Bandwidth        uint32             `json:"bandwidth,omitempty"`
+	AverageBandwidth uint32             `json:"averageBandwidth,omitempty"`
+	Codecs           string             `json:"codecs,omitempty"`
+	Resolution       string             `json:"resolution,omitempty"`
+	Audio            string             `json:"audio,omitempty"`
+	Video            string             `json:"video,omitempty"`
+	Subtitles        string             `json:"subtitles,omitempty"`
+	Captions         string             `json:"closedCaptions,omitempty"`
+	Name             string             `json:"name,omitempty"`
+	Iframe           bool               `json:"iframe,omitempty"`
+	VideoRange       string             `json:"videoRange,omitempty"`
+	HDCPLevel        string             `json:"hdcpLevel,omitempty"`
+	StableVariantId  string             `json:"stableVariantId,omitempty"`
+	FrameRate        float64            `json:"frameRate,omitempty"`
+	Renditions       []int              `json:"renditions,omitempty"`
+	Alternatives     []*jsonAlternative `json:"alternatives,omitempty"`
+	Custom           []jsonCustomTag    `json:"custom,omitempty"`
+}
+
+type jsonAlternative struct {
+	GroupId         string          `json:"groupId"`
+	URI             string          `json:"uri,omitempty"`
+	Type            string          `json:"type"`
+	Language        string          `json:"language,omitempty"`
+	Name            string          `json:"name"`
+	Default         bool            `json:"default,omitempty"`
+	Autoselect      string          `json:"autoselect,omitempty"`
+	Forced          string          `json:"forced,omitempty"`
+	Characteristics string          `json:"characteristics,omitempty"`
+	Subtitles       string          `json:"subtitles,omitempty"`
+	Custom          []jsonCustomTag `json:"custom,omitempty"`
+}
+
+type jsonKey struct {
+	Method            string `json:"method"`
+	URI               string `json:"uri,omitempty"`
+	IV                string `json:"iv,omitempty"`
+	Keyformat         string `json:"keyFormat,omitempty"`
+	Keyformatversions string `json:"keyFormatVersions,omitempty"`
+}
+
+type jsonMap struct {
+	URI    string `json:"uri"`
+	Limit  int64  `json:"limit,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+type jsonSCTE struct {
+	Syntax  string  `json:"syntax"`
+	CueType string  `json:"cueType"`
+	Cue     string  `json:"cue,omitempty"`
+	ID      string  `json:"id,omitempty"`
+	Time    float64 `json:"time,omitempty"`
+	Elapsed float64 `json:"elapsed,omitempty"`
+}
+
+type jsonWV struct {
+	AudioChannels          uint   `json:"audioChannels,omitempty"`
+	AudioFormat            uint   `json:"audioFormat,omitempty"`
+	AudioProfileIDC        uint   `json:"audioProfileIDC,omitempty"`
+	AudioSampleSize        uint   `json:"audioSampleSize,omitempty"`
+	AudioSamplingFrequency uint   `json:"audioSamplingFrequency,omitempty"`
+	CypherVersion          string `json:"cypherVersion,omitempty"`
+	ECM                    string `json:"ecm,omitempty"`
+	VideoFormat            uint   `json:"videoFormat,omitempty"`
+	VideoFrameRate         uint   `json:"videoFrameRate,omitempty"`
+	VideoLevelIDC          uint   `json:"videoLevelIDC,omitempty"`
+	VideoProfileIDC        uint   `json:"videoProfileIDC,omitempty"`
+	VideoResolution        string `json:"videoResolution,omitempty"`
+	VideoSAR               string `json:"videoSAR,omitempty"`
+}
+
+type jsonCustomTag struct {
+	Tag   string          `json:"tag"`
+	Line  string          `json:"line,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+type jsonEncoderOptions struct {
+	DurationPrecision int    `json:"durationPrecision,omitempty"`
+	DurationAsInt     bool   `json:"durationAsInt,omitempty"`
+	PDTLayout         string `json:"pdtLayout,omitempty"`
+	PDTUTC            bool   `json:"pdtUTC,omitempty"`
+	OmitDeprecated    bool   `json:"omitDeprecated,omitempty"`
+	CRLF              bool   `json:"crlf,omitempty"`
+	Strict            bool   `json:"strict,omitempty"`
+	Version           uint8  `json:"version,omitempty"`
+}
+
+// newJSONEncoderOptions returns nil for the default options so they
+// are omitted.
+func newJSONEncoderOptions(opts EncoderOptions) *jsonEncoderOptions {
+	if opts == (EncoderOptions{}) {
+		return nil
+	}
+	jo := jsonEncoderOptions(opts)
+	return &jo
+}
+
+func (jo *jsonEncoderOptions) options() EncoderOptions {
+	if jo == nil {
+		return EncoderOptions{}
+	}
+	return EncoderOptions(*jo)
+}
+
+// MarshalJSON encodes the master playlist to JSON of the schema
+// described by JSONSchemaVersion.
+func (p *MasterPlaylist) MarshalJSON() ([]byte, error) {
+	jp := &jsonMasterPlaylist{
+		Schema:              JSONSchemaVersion,
+		Version:             p.ver,
+		IndependentSegments: p.independentSegments,
+		Args:                p.Args,
+		CypherVersion:       p.CypherVersion,
+		Variants:            make([]*jsonVariant, 0, len(p.Variants)),
+	}
+	renditions := make(map[*Alternative]int)
+	for _, v := range p.Variants {
+		if v == nil {
+			jp.Variants = append(jp.Variants, nil)
+			continue
+		}
+		for _, alt := range v.Alternatives {
+			if _, ok := renditions[alt]; alt == nil || ok {
+				continue
+			}
+			jalt, err := newJSONAlternative(alt)
+			if err != nil {
+				return nil, err
+			}
+			renditions[alt] = len(jp.Renditions)
+			jp.Renditions = append(jp.Renditions, jalt)
+		}
+		jv, err := newJSONVariant(v, renditions)
+		if err != nil {
+			return nil, err
+		}
+		jp.Variants = append(jp.Variants, jv)
+	}
+	var err error
+	if jp.Custom, err = newJSONCustomTags(p.Custom, p.customOrder); err != nil {
+		return nil, err
+	}
+	jp.Encoder = newJSONEncoderOptions(p.encoder)
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON decodes the master playlist from JSON. Renditions
+// shared by the variants stay shared. Custom tags are restored with
+// the decoders of the playlist, see JSONTagDecoder.
+func (p *MasterPlaylist) UnmarshalJSON(data []byte) error {
+	var jp jsonMasterPlaylist
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+	if err := checkJSONSchema(jp.Schema); err != nil {
+		return err
+	}
+	decoders := indexCustomDecoders(p.customDecoders, p.registry.Decoders())
+	renditions := make([]*Alternative, 0, len(jp.Renditions))
+	for _, jalt := range jp.Renditions {
+		alt, err := jalt.alternative(decoders)
+		if err != nil {
+			return err
+		}
+		renditions = append(renditions, alt)
+	}
+	variants := make([]*Variant, 0, len(jp.Variants))
+	for _, jv := range jp.Variants {
+		v, err := jv.variant(renditions, decoders)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, v)
+	}
+	custom, order, err := jsonCustomTags(jp.Custom, decoders)
+	if err != nil {
+		return err
+	}
+	p.Variants = variants
+	p.Args = jp.Args
+	p.CypherVersion = jp.CypherVersion
+	p.ver = jp.Version
+	p.independentSegments = jp.IndependentSegments
+	p.Custom, p.customOrder = custom, order
+	p.encoder = jp.Encoder.options()
+	p.buf.Reset()
+	return nil
+}
+
+// MarshalJSON encodes the media playlist to JSON of the schema
+// described by JSONSchemaVersion. All the segments of the ring buffer
+// are written, not only the segments of the window.
+func (p *MediaPlaylist) MarshalJSON() ([]byte, error) {
+	jp := &jsonMediaPlaylist{
+		Schema:                JSONSchemaVersion,
+		Version:               p.ver,
+		TargetDuration:        p.TargetDuration,
+		MediaSequence:         p.SeqNo,
+		DiscontinuitySequence: p.DiscontinuitySeq,
+		IframesOnly:           p.Iframe,
+		Closed:                p.Closed,
+		StartTime:             p.StartTime,
+		StartTimePrecise:      p.StartTimePrecise,
+		Args:                  p.Args,
+		WinSize:               p.winsize,
+		Capacity:              p.capacity,
+		Head:                  p.head,
+		Key:                   p.Key,
+		Map:                   p.Map,
+		WV:                    p.WV,
+		Segments:              make([]*jsonMediaSegment, 0, p.count),
+	}
+	switch p.MediaType {
+	case EVENT:
+		jp.PlaylistType = "EVENT"
+	case VOD:
+		jp.PlaylistType = "VOD"
+	}
+	for i := uint(0); i < p.count; i++ {
+		seg := p.Segments[(p.head+i)%p.capacity]
+		if seg == nil {
+			jp.Segments = append(jp.Segments, nil)
+			continue
+		}
+		js, err := newJSONMediaSegment(seg)
+		if err != nil {
+			return nil, err
+		}
+		if seg.Key != nil && seg.Key == p.Key {
+			// Encode doesn't repeat the key shared with the playlist
+			js.Key, js.DefaultKey = nil, true
+		}
+		jp.Segments = append(jp.Segments, js)
+	}
+	var err error
+	if jp.Custom, err = newJSONCustomTags(p.Custom, p.customOrder); err != nil {
+		return nil, err
+	}
+	jp.Encoder = newJSONEncoderOptions(p.encoder)
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON decodes the media playlist from JSON. The segments
+// are placed to the ring buffer of the stored capacity from the
+// stored head so the playlist continues sliding the same way. Custom
+// tags are restored with the decoders of the playlist, see
+// JSONTagDecoder.
+func (p *MediaPlaylist) UnmarshalJSON(data []byte) error {
+	var jp jsonMediaPlaylist
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+	if err := checkJSONSchema(jp.Schema); err != nil {
+		return err
+	}
+	count := uint(len(jp.Segments))
+	switch {
+	case jp.Capacity < count:
+		return fmt.Errorf("capacity %d is less than the number of segments %d", jp.Capacity, count)
+	case jp.Capacity < jp.WinSize:
+		return fmt.Errorf("capacity %d is less than winsize %d", jp.Capacity, jp.WinSize)
+	case jp.Head > 0 && jp.Head >= jp.Capacity:
+		return fmt.Errorf("head %d is out of capacity %d", jp.Head, jp.Capacity)
+	}
+	var mediaType MediaType
+	switch jp.PlaylistType {
+	case "":
+	case "EVENT":
+		mediaType = EVENT
+	case "VOD":
+		mediaType = VOD
+	default:
+		return fmt.Errorf("unknown playlist type %q", jp.PlaylistType)
+	}
+
+	decoders := indexCustomDecoders(p.customDecoders, p.registry.Decoders())
+	segments := make([]*MediaSegment, jp.Capacity)
+	for i, js := range jp.Segments {
+		if js == nil {
+			continue
+		}
+		seg, err := js.segment(decoders)
+		if err != nil {
+			return err
+		}
+		if js.DefaultKey {
+			seg.Key = jp.Key
+		}
+		segments[(jp.Head+uint(i))%jp.Capacity] = seg
+	}
+	custom, order, err := jsonCustomTags(jp.Custom, decoders)
+	if err != nil {
+		return err
+	}
+	p.TargetDuration = jp.TargetDuration
+	p.SeqNo = jp.MediaSequence
+	p.DiscontinuitySeq = jp.DiscontinuitySequence
+	p.MediaType = mediaType
+	p.Iframe = jp.IframesOnly
+	p.Closed = jp.Closed
+	p.StartTime = jp.StartTime
+	p.StartTimePrecise = jp.StartTimePrecise
+	p.Args = jp.Args
+	p.Key = jp.Key
+	p.Map = jp.Map
+	p.WV = jp.WV
+	p.Segments = segments
+	p.winsize = jp.WinSize
+	p.capacity = jp.Capacity
+	p.head = jp.Head
+	p.tail = 0
+	if jp.Capacity > 0 {
+		p.tail = (jp.Head + count) % jp.Capacity
+	}
+	p.count = count
+	p.ver = jp.Version
+	p.Custom, p.customOrder = custom, order
+	p.encoder = jp.Encoder.options()
+	p.buf.Reset()
+	return nil
+}
+
+// MarshalJSON encodes the segment to JSON.
+func (seg *MediaSegment) MarshalJSON() ([]byte, error) {
+	js, err := newJSONMediaSegment(seg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON decodes the segment from JSON. Custom tags are
+// restored as plain lines, unmarshal the whole playlist to decode
+// them with the custom decoders.
+func (seg *MediaSegment) UnmarshalJSON(data []byte) error {
+	var js jsonMediaSegment
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	restored, err := js.segment(nil)
+	if err != nil {
+		return err
+	}
+	*seg = *restored
+	return nil
+}
+
+// MarshalJSON encodes the variant to JSON with its renditions.
+func (v *Variant) MarshalJSON() ([]byte, error) {
+	jv, err := newJSONVariant(v, nil)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jv)
+}
+
+// UnmarshalJSON decodes the variant from JSON. Custom tags are
+// restored as plain lines, unmarshal the whole playlist to decode
+// them with the custom decoders.
+func (v *Variant) UnmarshalJSON(data []byte) error {
+	var jv jsonVariant
+	if err := json.Unmarshal(data, &jv); err != nil {
+		return err
+	}
+	restored, err := jv.variant(nil, nil)
+	if err != nil {
+		return err
+	}
+	*v = *restored
+	return nil
+}
+
+// MarshalJSON encodes the rendition to JSON.
+func (a *Alternative) MarshalJSON() ([]byte, error) {
+	jalt, err := newJSONAlternative(a)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jalt)
+}
+
+// UnmarshalJSON decodes the rendition from JSON. Custom tags are
+// restored as plain lines, unmarshal the whole playlist to decode
+// them with the custom decoders.
+func (a *Alternative) UnmarshalJSON(data []byte) error {
+	var jalt jsonAlternative
+	if err := json.Unmarshal(data, &jalt); err != nil {
+		return err
+	}
+	restored, err := jalt.alternative(nil)
+	if err != nil {
+		return err
+	}
+	*a = *restored
+	return nil
+}
+
+// MarshalJSON encodes the key to JSON.
+func (k *Key) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonKey(*k))
+}
+
+// UnmarshalJSON decodes the key from JSON.
+func (k *Key) UnmarshalJSON(data []byte) error {
+	var jk jsonKey
+	if err := json.Unmarshal(data, &jk); err != nil {
+		return err
+	}
+	*k = Key(jk)
+	return nil
+}
+
+// MarshalJSON encodes the map to JSON.
+func (m *Map) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonMap(*m))
+}
+
+// UnmarshalJSON decodes the map from JSON.
+func (m *Map) UnmarshalJSON(data []byte) error {
+	var jm jsonMap
+	if err := json.Unmarshal(data, &jm); err != nil {
+		return err
+	}
+	*m = Map(jm)
+	return nil
+}
+
+// MarshalJSON encodes the Widevine parameters to JSON.
+func (wv *WV) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonWV(*wv))
+}
+
+// UnmarshalJSON decodes the Widevine parameters from JSON.
+func (wv *WV) UnmarshalJSON(data []byte) error {
+	var jwv jsonWV
+	if err := json.Unmarshal(data, &jwv); err != nil {
+		return err
+	}
+	*wv = WV(jwv)
+	return nil
+}
+
+// MarshalJSON encodes the SCTE-35 cue to JSON.
+func (s *SCTE) MarshalJSON() ([]byte, error) {
+	js := jsonSCTE{Cue: s.Cue, ID: s.ID, Time: s.Time, Elapsed: s.Elapsed}
+	switch s.Syntax {
+	case SCTE35_67_2014:
+		js.Syntax = "67-2014"
+	case SCTE35_OATCLS:
+		js.Syntax = "oatcls"
+	default:
+		return nil, fmt.Errorf("unknown SCTE-35 syntax %d", s.Syntax)
+	}
+	switch s.CueType {
+	case SCTE35Cue_Start:
+		js.CueType = "start"
+	case SCTE35Cue_Mid:
+		js.CueType = "mid"
+	case SCTE35Cue_End:
+		js.CueType = "end"
+	default:
+		return nil, fmt.Errorf("unknown SCTE-35 cue type %d", s.CueType)
+	}
+	return json.Marshal(js)
+}
+
+// UnmarshalJSON decodes the SCTE-35 cue from JSON.
+func (s *SCTE) UnmarshalJSON(data []byte) error {
+	var js jsonSCTE
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	scte := SCTE{Cue: js.Cue, ID: js.ID, Time: js.Time, Elapsed: js.Elapsed}
+	switch js.Syntax {
+	case "67-2014":
+		scte.Syntax = SCTE35_67_2014
+	case "oatcls":
+		scte.Syntax = SCTE35_OATCLS
+	default:
+		return fmt.Errorf("unknown SCTE-35 syntax %q", js.Syntax)
+	}
+	switch js.CueType {
+	case "start":
+		scte.CueType = SCTE35Cue_Start
+	case "mid":
+		scte.CueType = SCTE35Cue_Mid
+	case "end":
+		scte.CueType = SCTE35Cue_End
+	default:
+		return fmt.Errorf("unknown SCTE-35 cue type %q", js.CueType)
+	}
+	*s = scte
+	return nil
+}
+
+func checkJSONSchema(schema int) error {
+	if schema < 0 || schema > JSONSchemaVersion {
+		return fmt.Errorf("unsupported JSON schema version %d", schema)
+	}
+	return nil
+}
+
+func newJSONMediaSegment(seg *MediaSegment) (*jsonMediaSegment, error) {
+	js := &jsonMediaSegment{
+		SeqId:         seg.SeqId,
+		URI:           seg.URI,
+		Title:         seg.Title,
+		Duration:      seg.Duration,
+		Limit:         seg.Limit,
+		Offset:        seg.Offset,
+		Key:           seg.Key,
+		Map:           seg.Map,
+		Discontinuity: seg.Discontinuity,
+		SCTE:          seg.SCTE,
+	}
+	if !seg.ProgramDateTime.IsZero() {
+		js.ProgramDateTime = &seg.ProgramDateTime
+	}
+	var err error
+	js.Custom, err = newJSONCustomTags(seg.Custom, seg.customOrder)
+	return js, err
+}
+
+func (js *jsonMediaSegment) segment(decoders map[string][]CustomDecoder) (*MediaSegment, error) {
+	seg := &MediaSegment{
+		SeqId:         js.SeqId,
+		URI:           js.URI,
+		Title:         js.Title,
+		Duration:      js.Duration,
+		Limit:         js.Limit,
+		Offset:        js.Offset,
+		Key:           js.Key,
+		Map:           js.Map,
+		Discontinuity: js.Discontinuity,
+		SCTE:          js.SCTE,
+	}
+	if js.ProgramDateTime != nil {
+		seg.ProgramDateTime = *js.ProgramDateTime
+	}
+	var err error
+	seg.Custom, seg.customOrder, err = jsonCustomTags(js.Custom, decoders)
+	return seg, err
+}
+
+// newJSONVariant converts the variant. The renditions of the variant
+// are written as indexes if the index of the renditions is given.
+func newJSONVariant(v *Variant, renditions map[*Alternative]int) (*jsonVariant, error) {
+	jv := &jsonVariant{
+		URI:              v.URI,
+		Chunklist:        v.Chunklist,
+		ProgramId:        v.ProgramId,
+		Bandwidth:        v.Bandwidth,
+		AverageBandwidth: v.AverageBandwidth,
+		Codecs:           v.Codecs,
+		Resolution:       v.Resolution,
+		Audio:            v.Audio,
+		Video:            v.Video,
+		Subtitles:        v.Subtitles,
+		Captions:         v.Captions,
+		Name:             v.Name,
+		Iframe:           v.Iframe,
+		VideoRange:       v.VideoRange,
+		HDCPLevel:        v.HDCPLevel,
+		StableVariantId:  v.StableVariantId,
+		FrameRate:        v.FrameRate,
+	}
+	for _, alt := range v.Alternatives {
+		if alt == nil {
+			continue
+		}
+		if renditions != nil {
+			jv.Renditions = append(jv.Renditions, renditions[alt])
+			continue
+		}
+		jalt, err := newJSONAlternative(alt)
+		if err != nil {
+			return nil, err
+		}
+		jv.Alternatives = append(jv.Alternatives, jalt)
+	}
+	var err error
+	jv.Custom, err = newJSONCustomTags(v.Custom, v.customOrder)
+	return jv, err
+}
+
+func (jv *jsonVariant) variant(renditions []*Alternative, decoders map[string][]CustomDecoder) (*Variant, error) {
+	if jv == nil {
+		return nil, nil
+	}
+	v := &Variant{
+		URI:       jv.URI,
+		Chunklist: jv.Chunklist,
+		VariantParams: VariantParams{
+			ProgramId:        jv.ProgramId,
+			Bandwidth:        jv.Bandwidth,
+			AverageBandwidth: jv.AverageBandwidth,
+			Codecs:           jv.Codecs,
+			Resolution:       jv.Resolution,
+			Audio:            jv.Audio,
+			Video:            jv.Video,
+			Subtitles:        jv.Subtitles,
+			Captions:         jv.Captions,
+			Name:             jv.Name,
+			Iframe:           jv.Iframe,
+			VideoRange:       jv.VideoRange,
+			HDCPLevel:        jv.HDCPLevel,
+			StableVariantId:  jv.StableVariantId,
+			FrameRate:        jv.FrameRate,
+		},
+	}
+	for _, i := range jv.Renditions {
+		if i < 0 || i >= len(renditions) {
+			return nil, fmt.Errorf("variant %s refers to rendition %d out of %d", jv.URI, i, len(renditions))
+		}
+		v.Alternatives = append(v.Alternatives, renditions[i])
+	}
+	for _, jalt := range jv.Alternatives {
+		alt, err := jalt.alternative(decoders)
+		if err != nil {
+			return nil, err
+		}
+		v.Alternatives = append(v.Alternatives, alt)
+	}
+	var err error
+	v.Custom, v.customOrder, err = jsonCustomTags(jv.Custom, decoders)
+	return v, err
+}
+
+func newJSONAlternative(alt *Alternative) (*jsonAlternative, error) {
+	jalt := &jsonAlternative{
+		GroupId:         alt.GroupId,
+		URI:             alt.URI,
+		Type:            alt.Type,
+		Language:        alt.Language,
+		Name:            alt.Name,
+		Default:         alt.Default,
+		Autoselect:      alt.Autoselect,
+		Forced:          alt.Forced,
+		Characteristics: alt.Characteristics,
+		Subtitles:       alt.Subtitles,
+	}
+	var err error
+	jalt.Custom, err = newJSONCustomTags(alt.Custom, alt.customOrder)
+	return jalt, err
+}
+
+func (jalt *jsonAlternative) alternative(decoders map[string][]CustomDecoder) (*Alternative, error) {
+	if jalt == nil {
+		return nil, nil
+	}
+	alt := &Alternative{
+		GroupId:         jalt.GroupId,
+		URI:             jalt.URI,
+		Type:            jalt.Type,
+		Language:        jalt.Language,
+		Name:            jalt.Name,
+		Default:         jalt.Default,
+		Autoselect:      jalt.Autoselect,
+		Forced:          jalt.Forced,
+		Characteristics: jalt.Characteristics,
+		Subtitles:       jalt.Subtitles,
+	}
+	var err error
+	alt.Custom, alt.customOrder, err = jsonCustomTags(jalt.Custom, decoders)
+	return alt, err
+}
+
+// newJSONCustomTags converts the custom tags in the order of Encode.
+// Each instance of the repeated tags is converted separately.
+func newJSONCustomTags(custom map[string]CustomTag, order []string) ([]jsonCustomTag, error) {
+	var tags []jsonCustomTag
+	for _, t := range orderedCustomTags(custom, order) {
+		if t.tag == nil {
+			continue
+		}
+		jt := jsonCustomTag{Tag: t.name}
+		if buf := t.tag.Encode(); buf != nil {
+			jt.Line = buf.String()
+		}
+		if _, ok := t.tag.(json.Marshaler); ok {
+			value, err := json.Marshal(t.tag)
+			if err != nil {
+				return nil, fmt.Errorf("custom tag %s: %w", t.name, err)
+			}
+			jt.Value = value
+		}
+		tags = append(tags, jt)
+	}
+	return tags, nil
+}
+
+// jsonCustomTags restores the custom tags with the first decoder of
+// the tag which succeeds. The error of the first failed decoder is
+// returned when none of them succeeds. Tags without decoders or with
+// the decoders which return nil are kept as plain lines.
+func jsonCustomTags(tags []jsonCustomTag, decoders map[string][]CustomDecoder) (map[string]CustomTag, []string, error) {
+	var (
+		custom map[string]CustomTag
+		order  []string
+	)
+	for _, jt := range tags {
+		name, _ := splitTag(jt.Tag)
+		var (
+			tag      CustomTag
+			firstErr error
+		)
+		for _, decoder := range decoders[name] {
+			var err error
+			if jd, ok := decoder.(JSONTagDecoder); ok && jt.Value != nil {
+				tag, err = jd.DecodeJSON(jt.Value)
+			} else if jt.Line != "" {
+				tag, err = decoder.Decode(jt.Line)
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				tag = nil
+				continue
+			}
+			if tag != nil {
+				break
+			}
+		}
+		if tag == nil && firstErr != nil {
+			return nil, nil, fmt.Errorf("custom tag %s: %w", jt.Tag, firstErr)
+		}
+		if tag == nil {
+			tag = &rawTag{name: jt.Tag, line: jt.Line}
+		}
+		addCustomTag(&custom, &order, jt.Tag, tag)
+	}
+	return custom, order, nil
+}
+
+// rawTag is the custom tag restored from JSON without a decoder. It
+// encodes to the stored line.
+type rawTag struct {
+	name string
+	line string
+}
+
+func (t *rawTag) TagName() string {
+	return t.name
+}
+
+func (t *rawTag) Encode() *bytes.Buffer {
+	if t.line == "" {
+		return nil
+	}
+	return bytes.NewBufferString(t.line)
+}
+
+func (t *rawTag) String() string {
+	return t.line
+}
@@ -0,0 +1,368 @@
+/*
+JSON marshaling tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scoreTag is a custom tag stored in JSON as its own value.
+type scoreTag struct {
+	Score int `json:"score"`
+}
+
+func (t *scoreTag) TagName() string {
+	return "#X-SCORE:"
+}
+
+func (t *scoreTag) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.String())
+}
+
+func (t *scoreTag) String() string {
+	return "#X-SCORE:" + strconv.Itoa(t.Score)
+}
+
+func (t *scoreTag) MarshalJSON() ([]byte, error) {
+	type plain scoreTag
+	return json.Marshal((*plain)(t))
+}
+
+// scoreDecoder decodes scoreTag from lines and from JSON.
+type scoreDecoder struct{}
+
+func (scoreDecoder) TagName() string {
+	return "#X-SCORE:"
+}
+
+func (scoreDecoder) Decode(line string) (CustomTag, error) {
+	score, err := strconv.Atoi(strings.TrimPrefix(line, "#X-SCORE:"))
+	return &scoreTag{Score: score}, err
+}
+
+func (scoreDecoder) SegmentTag() bool {
+	return true
+}
+
+func (scoreDecoder) DecodeJSON(value []byte) (CustomTag, error) {
+	tag := new(scoreTag)
+	err := json.Unmarshal(value, tag)
+	return tag, err
+}
+
+func TestJSONSamplePlaylists(t *testing.T) {
+	files, err := filepath.Glob("sample-playlists/*.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, listType, err := DecodeFrom(bufio.NewReader(f), false)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		var restored Playlist
+		if listType == MASTER {
+			restored = NewMasterPlaylist()
+		} else {
+			restored = new(MediaPlaylist)
+		}
+		if err = json.Unmarshal(data, restored); err != nil {
+			t.Fatalf("%s: %v\n%s", file, err, data)
+		}
+		if restored.String() != p.String() {
+			t.Errorf("%s: got playlist\n%s\nexpected\n%s", file, restored, p)
+		}
+	}
+}
+
+func TestJSONMediaPlaylist(t *testing.T) {
+	registry := NewRegistry()
+	RegisterTag(registry, "#X-ASSET:", decodeAssetTag, TagOptions{Segment: true})
+
+	p, err := NewMediaPlaylist(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithRegistry(registry)
+	p.WithCustomDecoders([]CustomDecoder{scoreDecoder{}})
+	p.SetDefaultKey("AES-128", "https://example.com/key", "", "", "")
+	p.SetDefaultMap("init.mp4", 0, 0)
+	p.MediaType = EVENT
+	p.StartTime = 2.5
+	p.StartTimePrecise = true
+	p.SetCustomTag(&lineTagDecoder{name: "#X-UNKNOWN", line: "#X-UNKNOWN:1"})
+	for i := 0; i < 4; i++ {
+		if err := p.Append("seg"+strconv.Itoa(i)+".m4s", 6, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		p.Remove()
+	}
+	p.Append("seg4.m4s", 6, "title")
+	p.SetDiscontinuity(0)
+	p.SetProgramDateTime(time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC))
+	p.SetSCTE35(&SCTE{Syntax: SCTE35_OATCLS, CueType: SCTE35Cue_Mid, Cue: "/DAA", Time: 30, Elapsed: 12})
+	p.AddCustomSegmentTag(&assetTag{ID: 1})
+	p.AddCustomSegmentTag(&assetTag{ID: 2})
+	p.AddCustomSegmentTag(&scoreTag{Score: 7})
+	p.Append("seg5.m4s", 6, "")
+	p.SetKey("AES-128", "https://example.com/key2", "0x1234", "", "")
+	p.SetVersion(5)
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{`"schema":1`, `"head":2`, `"capacity":5`, `"winSize":3`, `"value":{"score":7}`, `"programDateTime":"2020-01-02T03:04:05.006Z"`} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf("JSON doesn't contain %s:\n%s", expected, data)
+		}
+	}
+
+	restored, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored.WithRegistry(registry)
+	restored.WithCustomDecoders([]CustomDecoder{scoreDecoder{}})
+	if err = json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.head != p.head || restored.tail != p.tail || restored.count != p.count ||
+		restored.capacity != p.capacity || restored.winsize != p.winsize || restored.ver != p.ver {
+		t.Fatalf("Ring buffer is not restored: %d/%d/%d/%d/%d/%d", restored.head, restored.tail, restored.count, restored.capacity, restored.winsize, restored.ver)
+	}
+	for i := p.head; i != p.tail; i = (i + 1) % p.capacity {
+		if !reflect.DeepEqual(restored.Segments[i], p.Segments[i]) {
+			t.Errorf("Segment %d is\n%+v\nexpected\n%+v", i, restored.Segments[i], p.Segments[i])
+		}
+	}
+	if restored.String() != p.String() {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", restored, p)
+	}
+	seg := restored.Segments[(restored.tail+restored.capacity-2)%restored.capacity]
+	if tags := TagsOf[*assetTag](seg.Custom, "#X-ASSET:"); len(tags) != 2 || tags[1].ID != 2 {
+		t.Errorf("Got asset tags %v", tags)
+	}
+	if tag, ok := TagOf[*scoreTag](seg.Custom, "#X-SCORE:"); !ok || tag.Score != 7 {
+		t.Errorf("Got score tag %v", tag)
+	}
+	if tag, ok := restored.Custom["#X-UNKNOWN"]; !ok || tag.String() != "#X-UNKNOWN:1" {
+		t.Errorf("Got unknown tag %v", tag)
+	}
+
+	// both playlists keep sliding the same way
+	p.Slide("seg6.m4s", 6, "")
+	restored.Slide("seg6.m4s", 6, "")
+	if restored.String() != p.String() {
+		t.Errorf("Got slided playlist\n%s\nexpected\n%s", restored, p)
+	}
+}
+
+func TestJSONMasterPlaylist(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-alternatives.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), false); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	p.SetIndependentSegments(true)
+	p.Variants[0].AddCustomTag(&lineTagDecoder{name: "#X-VARIANT", line: "#X-VARIANT:low"})
+	p.Variants[0].Chunklist, _ = NewMediaPlaylist(1, 1)
+	p.Variants[0].Chunklist.Append("a.ts", 10, "")
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewMasterPlaylist()
+	if err = json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if !restored.IndependentSegments() || restored.Version() != p.Version() {
+		t.Errorf("Got independent segments %v and version %d", restored.IndependentSegments(), restored.Version())
+	}
+	if restored.String() != p.String() {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", restored, p)
+	}
+	if restored.Variants[0].Chunklist.String() != p.Variants[0].Chunklist.String() {
+		t.Errorf("Got chunklist\n%s", restored.Variants[0].Chunklist)
+	}
+	for i, v := range p.Variants {
+		for j, alt := range v.Alternatives {
+			for k, other := range p.Variants {
+				for l, otherAlt := range other.Alternatives {
+					shared := restored.Variants[i].Alternatives[j] == restored.Variants[k].Alternatives[l]
+					if shared != (alt == otherAlt) {
+						t.Fatalf("Sharing of rendition %d/%d and %d/%d is not restored", i, j, k, l)
+					}
+				}
+			}
+		}
+	}
+
+	// variants outside of the master playlist hold their renditions
+	data, err = json.Marshal(p.Variants[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v Variant
+	if err = json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.Alternatives, p.Variants[0].Alternatives) {
+		t.Errorf("Got renditions %+v", v.Alternatives)
+	}
+}
+
+func TestJSONEncoderOptions(t *testing.T) {
+	p, err := NewMediaPlaylist(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Append("a.ts", 9.5, "")
+	p.SetProgramDateTime(time.Date(2020, 1, 1, 10, 0, 0, 0, time.FixedZone("", 3600)))
+	p.Append("b.ts", 10, "")
+	p.SetEncoderOptions(EncoderOptions{DurationAsInt: true, PDTUTC: true, CRLF: true, Version: 4})
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := new(MediaPlaylist)
+	if err = json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if restored.String() != p.String() {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", restored, p)
+	}
+
+	m := NewMasterPlaylist()
+	m.Append("low.m3u8", nil, VariantParams{ProgramId: 1, Bandwidth: 1})
+	m.SetEncoderOptions(EncoderOptions{OmitDeprecated: true, Version: 6})
+	if data, err = json.Marshal(m); err != nil {
+		t.Fatal(err)
+	}
+	restoredMaster := NewMasterPlaylist()
+	if err = json.Unmarshal(data, restoredMaster); err != nil {
+		t.Fatal(err)
+	}
+	if restoredMaster.String() != m.String() {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", restoredMaster, m)
+	}
+
+	// the default options are omitted
+	if data, err = json.Marshal(NewMasterPlaylist()); err != nil || bytes.Contains(data, []byte(`"encoder"`)) {
+		t.Errorf("Got %s, %v", data, err)
+	}
+}
+
+func TestJSONCustomTagDecoders(t *testing.T) {
+	p, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetCustomTag(&scoreTag{Score: 7})
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the decoder after the failed one restores the tag
+	failing := &MockCustomTag{name: "#X-SCORE:", err: errors.New("no score")}
+	restored := new(MediaPlaylist)
+	restored.WithCustomDecoders([]CustomDecoder{failing, scoreDecoder{}})
+	if err = json.Unmarshal(data, restored); err != nil {
+		t.Fatal(err)
+	}
+	if tag, ok := TagOf[*scoreTag](restored.Custom, "#X-SCORE:"); !ok || tag.Score != 7 {
+		t.Errorf("Got score tag %v", restored.Custom)
+	}
+
+	// the error is returned when all the decoders fail
+	restored = new(MediaPlaylist)
+	restored.WithCustomDecoders([]CustomDecoder{failing})
+	if err = json.Unmarshal(data, restored); err == nil || !strings.Contains(err.Error(), "no score") {
+		t.Errorf("Got error %v, expected the error of the decoder", err)
+	}
+}
+
+func TestJSONSharedKey(t *testing.T) {
+	shared, err := NewMediaPlaylist(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared.SetDefaultKey("AES-128", "key1", "", "", "")
+	shared.AppendSegment(&MediaSegment{URI: "a.ts", Duration: 10, Key: shared.Key})
+	shared.AppendSegment(&MediaSegment{URI: "b.ts", Duration: 10, Key: &Key{Method: "AES-128", URI: "key2"}})
+	decoded := decodeMedia(t, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-KEY:METHOD=AES-128,URI=\"key1\"\n#EXTINF:10,\na.ts\n")
+
+	for _, p := range []*MediaPlaylist{shared, decoded} {
+		data, err := json.Marshal(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored := new(MediaPlaylist)
+		if err = json.Unmarshal(data, restored); err != nil {
+			t.Fatal(err)
+		}
+		if restored.String() != p.String() {
+			t.Errorf("Got playlist\n%s\nexpected\n%s", restored, p)
+		}
+	}
+	if strings.Count(shared.String(), "key1") != 1 {
+		t.Errorf("Shared key is repeated:\n%s", shared)
+	}
+}
+
+func TestJSONUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		data     string
+		expected string
+	}{
+		{`{"schema":2,"segments":[]}`, "unsupported JSON schema version 2"},
+		{`{"schema":1,"capacity":1,"segments":[{"uri":"a.ts"},{"uri":"b.ts"}]}`, "capacity 1 is less than the number of segments 2"},
+		{`{"schema":1,"capacity":1,"head":1,"segments":[]}`, "head 1 is out of capacity 1"},
+		{`{"schema":1,"playlistType":"LIVE","segments":[]}`, `unknown playlist type "LIVE"`},
+		{`{"segments":[{"uri":"a.ts","scte":{"syntax":"x","cueType":"start"}}],"capacity":1}`, `unknown SCTE-35 syntax "x"`},
+	}
+	for _, tt := range tests {
+		err := json.Unmarshal([]byte(tt.data), new(MediaPlaylist))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%s: got error %v, expected %q", tt.data, err, tt.expected)
+		}
+	}
+	err := json.Unmarshal([]byte(`{"variants":[{"uri":"a.m3u8","renditions":[0]}]}`), NewMasterPlaylist())
+	if err == nil || !strings.Contains(err.Error(), "refers to rendition 0 out of 0") {
+		t.Errorf("Got error %v for missing rendition", err)
+	}
+}
@@ -0,0 +1,191 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines lint profiles of playlists.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// LintProfile selects the rules checked by Lint.
+type LintProfile int
+
+const (
+	// ProfileRFC8216 checks the rules of Validate.
+	ProfileRFC8216 LintProfile = iota
+	// ProfileAppleHLS checks the rules of Validate and the rules of
+	// HLS Authoring Specification for Apple Devices.
+	ProfileAppleHLS
+)
+
+// Rules of HLS Authoring Specification for Apple Devices checked by
+// ProfileAppleHLS.
+const (
+	RuleAppleTargetDuration   = "apple-target-duration"   // target duration should be 6 seconds
+	RuleAppleAverageBandwidth = "apple-average-bandwidth" // AVERAGE-BANDWIDTH must be present on every variant
+	RuleAppleCodecs           = "apple-codecs"            // CODECS must be present on every variant
+	RuleAppleFrameRate        = "apple-frame-rate"        // FRAME-RATE must be present on video variants
+	RuleAppleIframePlaylists  = "apple-i-frame-playlists" // I-frame playlists must be provided for video
+	RuleAppleVideoRange       = "apple-video-range"       // VIDEO-RANGE must agree with the video codec
+	RuleAppleBitrateLadder    = "apple-bitrate-ladder"    // adjacent bit rates should be a factor of 1.5 to 2 apart
+)
+
+const (
+	appleTargetDuration = 6   // seconds
+	appleLadderMinStep  = 1.5 // minimal ratio of adjacent bit rates
+	appleLadderMaxStep  = 2.0 // maximal ratio of adjacent bit rates
+)
+
+// Lint checks the media playlist with the rules of the profile and
+// returns all the violations found.
+func (p *MediaPlaylist) Lint(profile LintProfile) []Violation {
+	violations := p.Validate()
+	if profile == ProfileAppleHLS {
+		violations = append(violations, lintAppleMedia(p)...)
+	}
+	return violations
+}
+
+// Lint checks the master playlist and the media playlists linked to
+// its variants as Chunklist with the rules of the profile and returns
+// all the violations found.
+func (p *MasterPlaylist) Lint(profile LintProfile) []Violation {
+	violations := p.Validate()
+	if profile == ProfileAppleHLS {
+		violations = append(violations, lintAppleMaster(p)...)
+	}
+	checked := make(map[*MediaPlaylist]bool)
+	for _, v := range p.Variants {
+		if v.Chunklist == nil || checked[v.Chunklist] {
+			continue
+		}
+		checked[v.Chunklist] = true
+		violations = append(violations, v.Chunklist.Lint(profile)...)
+	}
+	return violations
+}
+
+func lintAppleMedia(p *MediaPlaylist) []Violation {
+	var violations []Violation
+	// target duration of I-frame playlists follows the key frames
+	if target := math.Ceil(p.TargetDuration); !p.Iframe && target != appleTargetDuration {
+		violations = append(violations, Violation{RuleAppleTargetDuration, SeverityWarning, p,
+			fmt.Sprintf("target duration %v differs from recommended %d seconds", target, appleTargetDuration)})
+	}
+	return violations
+}
+
+func lintAppleMaster(p *MasterPlaylist) []Violation {
+	var violations []Violation
+	add := func(rule string, severity Severity, object interface{}, format string, args ...interface{}) {
+		violations = append(violations, Violation{rule, severity, object, fmt.Sprintf(format, args...)})
+	}
+
+	var (
+		hasVideo  bool
+		hasIframe bool
+		ladders   = make(map[string][]*Variant)
+		order     []string
+	)
+	for _, v := range p.Variants {
+		tag := "EXT-X-STREAM-INF"
+		if v.Iframe {
+			tag = "EXT-X-I-FRAME-STREAM-INF"
+			hasIframe = true
+		}
+		if v.AverageBandwidth == 0 && !v.Iframe {
+			add(RuleAppleAverageBandwidth, SeverityError, v, "%s of %s has no AVERAGE-BANDWIDTH", tag, v.URI)
+		}
+		if v.Codecs == "" {
+			add(RuleAppleCodecs, SeverityError, v, "%s of %s has no CODECS", tag, v.URI)
+		}
+		codec := videoCodec(v.Codecs)
+		if codec == "" && v.Resolution == "" {
+			continue
+		}
+		if !v.Iframe {
+			hasVideo = true
+			if v.FrameRate == 0 {
+				add(RuleAppleFrameRate, SeverityError, v, "%s of %s has no FRAME-RATE", tag, v.URI)
+			}
+			ladder := codecFamily(codec) + "/" + v.VideoRange
+			if _, ok := ladders[ladder]; !ok {
+				order = append(order, ladder)
+			}
+			ladders[ladder] = append(ladders[ladder], v)
+		}
+		if codec != "" && !videoRangeAgrees(codec, v.VideoRange) {
+			add(RuleAppleVideoRange, SeverityError, v, "%s of %s has VIDEO-RANGE %q which doesn't agree with codec %s", tag, v.URI, v.VideoRange, codec)
+		}
+	}
+	if hasVideo && !hasIframe {
+		add(RuleAppleIframePlaylists, SeverityError, p, "no EXT-X-I-FRAME-STREAM-INF for video variants")
+	}
+
+	for _, ladder := range order {
+		variants := ladders[ladder]
+		sort.SliceStable(variants, func(i, j int) bool { return variants[i].Bandwidth < variants[j].Bandwidth })
+		for i := 1; i < len(variants); i++ {
+			prev, cur := variants[i-1], variants[i]
+			if prev.Bandwidth == 0 || prev.Bandwidth == cur.Bandwidth {
+				// the same rung for other renditions
+				continue
+			}
+			step := float64(cur.Bandwidth) / float64(prev.Bandwidth)
+			if step < appleLadderMinStep || step > appleLadderMaxStep {
+				add(RuleAppleBitrateLadder, SeverityWarning, cur, "bit rate of %s is %.2f times bit rate of %s", cur.URI, step, prev.URI)
+			}
+		}
+	}
+	return violations
+}
+
+// videoCodecs are the prefixes of video codecs in CODECS attribute.
+var videoCodecs = []string{"avc1", "avc3", "hvc1", "hev1", "dvh1", "dvhe", "dva1", "dvav", "av01", "vp09"}
+
+// videoCodec returns the first video codec of CODECS attribute.
+func videoCodec(codecs string) string {
+	for _, codec := range strings.Split(codecs, ",") {
+		codec = strings.TrimSpace(codec)
+		for _, prefix := range videoCodecs {
+			if strings.HasPrefix(codec, prefix) {
+				return codec
+			}
+		}
+	}
+	return ""
+}
+
+// codecFamily returns the codec without profile and level.
+func codecFamily(codec string) string {
+	family, _, _ := strings.Cut(codec, ".")
+	return family
+}
+
+// videoRangeAgrees checks VIDEO-RANGE against the video codec. Dolby
+// Vision is HDR so it requires PQ or HLG. HDR requires 10 bit so it is
+// not possible with H.264 and with Main profile of HEVC.
+func videoRangeAgrees(codec, videoRange string) bool {
+	hdr := videoRange == "PQ" || videoRange == "HLG"
+	family, profile, _ := strings.Cut(codec, ".")
+	switch family {
+	case "dvh1", "dvhe", "dva1", "dvav":
+		return hdr
+	case "avc1", "avc3":
+		return !hdr
+	case "hvc1", "hev1":
+		return !hdr || profile != "1" && !strings.HasPrefix(profile, "1.")
+	}
+	return true
+}
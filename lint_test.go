@@ -0,0 +1,70 @@
+/*
+Playlist lint profile tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLintAppleSample(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-hlsv7.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p := NewMasterPlaylist()
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range p.Lint(ProfileAppleHLS) {
+		if v.Severity == SeverityError {
+			t.Errorf("Unexpected violation %v", v)
+		}
+	}
+}
+
+func TestLintAppleProfile(t *testing.T) {
+	chunklist, err := NewMediaPlaylist(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunklist.Append("a.ts", 10, "")
+
+	m := NewMasterPlaylist()
+	m.Append("low.m3u8", chunklist, VariantParams{Bandwidth: 1000000, Codecs: "avc1.4d401f,mp4a.40.2", Resolution: "640x360"})
+	m.Append("high.m3u8", chunklist, VariantParams{Bandwidth: 5000000, AverageBandwidth: 4000000, Codecs: "avc1.640028", Resolution: "1920x1080", FrameRate: 25})
+	m.Append("hdr.m3u8", chunklist, VariantParams{Bandwidth: 6000000, AverageBandwidth: 5000000, Codecs: "avc1.640028", Resolution: "1920x1080", FrameRate: 25, VideoRange: "PQ"})
+	m.Append("audio.m3u8", nil, VariantParams{Bandwidth: 64000})
+
+	if violations := m.Lint(ProfileRFC8216); violations != nil {
+		t.Errorf("Got violations %v for RFC 8216 profile", violations)
+	}
+	expected := []string{
+		RuleAppleAverageBandwidth, RuleAppleFrameRate, // low.m3u8
+		RuleAppleVideoRange,                        // hdr.m3u8
+		RuleAppleAverageBandwidth, RuleAppleCodecs, // audio.m3u8
+		RuleAppleIframePlaylists,
+		RuleAppleBitrateLadder, // from low.m3u8 to high.m3u8, hdr.m3u8 is in own ladder
+		RuleAppleTargetDuration,
+	}
+	violations := m.Lint(ProfileAppleHLS)
+	if got := rules(violations); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Got violations %v, expected %v", got, expected)
+	}
+	if v := violations[len(violations)-2].Object.(*Variant); v.URI != "high.m3u8" {
+		t.Errorf("Bitrate ladder violation of %s", v.URI)
+	}
+	if violations[len(violations)-1].Object != chunklist {
+		t.Errorf("Target duration violation of %v", violations[len(violations)-1].Object)
+	}
+}
@@ -0,0 +1,122 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines live media playlist safe for concurrent use.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// LivePlaylist wraps a media playlist for the typical live streaming
+// setup where a packager appends segments from one goroutine while
+// many HTTP handlers serve the playlist. Writers are serialized and
+// encode a new snapshot of the playlist after each change. Readers
+// get the last snapshot without locking so writers never block them
+// and they never see a half updated playlist.
+type LivePlaylist struct {
+	mu       sync.Mutex // serializes writers
+	playlist *MediaPlaylist
+	snapshot atomic.Pointer[[]byte]
+}
+
+// NewLivePlaylist creates a live playlist. Winsize and capacity have
+// the same meaning as for NewMediaPlaylist.
+func NewLivePlaylist(winsize uint, capacity uint) (*LivePlaylist, error) {
+	p, err := NewMediaPlaylist(winsize, capacity)
+	if err != nil {
+		return nil, err
+	}
+	return LiveMediaPlaylist(p), nil
+}
+
+// LiveMediaPlaylist wraps the existing media playlist. The playlist
+// must not be used directly after that.
+func LiveMediaPlaylist(p *MediaPlaylist) *LivePlaylist {
+	l := &LivePlaylist{playlist: p}
+	l.publish()
+	return l
+}
+
+// publish encodes the playlist and makes it available to readers.
+func (l *LivePlaylist) publish() {
+	data := l.playlist.EncodeWithOptions(l.playlist.encoder).Bytes()
+	l.snapshot.Store(&data)
+}
+
+// Update calls the function with the wrapped playlist for any
+// changes not covered by the other methods, for example setting keys
+// or custom tags of the last segment. The new snapshot is published
+// after the function returns, even with an error.
+func (l *LivePlaylist) Update(change func(p *MediaPlaylist) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := change(l.playlist)
+	l.publish()
+	return err
+}
+
+// Append appends the segment like MediaPlaylist.Append.
+func (l *LivePlaylist) Append(uri string, duration float64, title string) error {
+	return l.Update(func(p *MediaPlaylist) error {
+		return p.Append(uri, duration, title)
+	})
+}
+
+// AppendSegment appends the segment like MediaPlaylist.AppendSegment.
+func (l *LivePlaylist) AppendSegment(seg *MediaSegment) error {
+	return l.Update(func(p *MediaPlaylist) error {
+		return p.AppendSegment(seg)
+	})
+}
+
+// Slide removes the first segment and appends the new one like
+// MediaPlaylist.Slide.
+func (l *LivePlaylist) Slide(uri string, duration float64, title string) {
+	l.Update(func(p *MediaPlaylist) error {
+		p.Slide(uri, duration, title)
+		return nil
+	})
+}
+
+// Remove removes the first segment like MediaPlaylist.Remove.
+func (l *LivePlaylist) Remove() error {
+	return l.Update(func(p *MediaPlaylist) error {
+		return p.Remove()
+	})
+}
+
+// Close closes the playlist like MediaPlaylist.Close.
+func (l *LivePlaylist) Close() {
+	l.Update(func(p *MediaPlaylist) error {
+		p.Close()
+		return nil
+	})
+}
+
+// Bytes returns the last snapshot of the encoded playlist. The
+// snapshot is shared between readers so it must not be modified.
+func (l *LivePlaylist) Bytes() []byte {
+	return *l.snapshot.Load()
+}
+
+// String returns the last snapshot of the encoded playlist.
+func (l *LivePlaylist) String() string {
+	return string(l.Bytes())
+}
+
+// WriteTo writes the last snapshot of the encoded playlist to the
+// writer.
+func (l *LivePlaylist) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(l.Bytes())
+	return int64(n), err
+}
@@ -0,0 +1,90 @@
+/*
+Live playlist tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLivePlaylistSnapshots(t *testing.T) {
+	l, err := NewLivePlaylist(3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(l.String(), "#EXTM3U\n") {
+		t.Errorf("Empty playlist not published:\n%s", l.String())
+	}
+	for i := 0; i < 3; i++ {
+		l.Slide(fmt.Sprintf("test%d.ts", i), 5.0, "")
+	}
+	before := l.Bytes()
+	expected := string(before)
+	l.Slide("test3.ts", 5.0, "")
+	if string(before) != expected {
+		t.Error("Snapshot changed after Slide")
+	}
+	after := l.String()
+	if strings.Contains(after, "test0.ts") || !strings.Contains(after, "#EXT-X-MEDIA-SEQUENCE:1\n") || !strings.Contains(after, "test3.ts") {
+		t.Errorf("Unexpected snapshot after Slide:\n%s", after)
+	}
+
+	err = l.Update(func(p *MediaPlaylist) error {
+		return p.SetDiscontinuity(0)
+	})
+	if err != nil || !strings.Contains(l.String(), "#EXT-X-DISCONTINUITY\n#EXTINF:5.000,\ntest3.ts") {
+		t.Errorf("Update not published: %v\n%s", err, l.String())
+	}
+
+	l.Close()
+	buf := new(bytes.Buffer)
+	if _, err = l.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "#EXT-X-ENDLIST\n") {
+		t.Errorf("Closed playlist not published:\n%s", buf.String())
+	}
+}
+
+func TestLivePlaylistConcurrentUse(t *testing.T) {
+	l, err := NewLivePlaylist(5, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Slide(fmt.Sprintf("test%d.ts", i), 5.0, "")
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				p, _, err := DecodeFrom(bytes.NewReader(l.Bytes()), true)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if n := p.(*MediaPlaylist).Count(); n > 5 {
+					t.Errorf("Snapshot contains %d segments, window is 5", n)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
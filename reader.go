@@ -16,36 +16,85 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"regexp"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var reKeyValue = regexp.MustCompile(`([a-zA-Z0-9_-]+)=("[^"]+"|[^",]+)`)
-
 // TimeParse allows globally apply and/or override Time Parser function.
 // Available variants:
 //   - FullTimeParse - implements full featured ISO/IEC 8601:2004
 //   - StrictTimeParse - implements only RFC3339 Nanoseconds format
 var TimeParse func(value string) (time.Time, error) = FullTimeParse
 
+// Errors returned when the decoded playlist exceeds one of the
+// DecodeLimits. All of them wrap ErrLimitExceeded so it may be checked
+// with errors.Is regardless of the particular limit.
+var (
+	ErrLimitExceeded     = errors.New("decoder limit exceeded")
+	ErrTooManyBytes      = fmt.Errorf("%w: too many bytes", ErrLimitExceeded)
+	ErrTooManyLines      = fmt.Errorf("%w: too many lines", ErrLimitExceeded)
+	ErrLineTooLong       = fmt.Errorf("%w: line too long", ErrLimitExceeded)
+	ErrTooManySegments   = fmt.Errorf("%w: too many segments", ErrLimitExceeded)
+	ErrTooManyVariants   = fmt.Errorf("%w: too many variants", ErrLimitExceeded)
+	ErrTooManyAttributes = fmt.Errorf("%w: too many attributes", ErrLimitExceeded)
+)
+
+// DecodeLimits restricts resources which the decoder may consume on
+// untrusted input. Zero value of a field means no limit. Limits are
+// applied in both strict and non-strict modes.
+type DecodeLimits struct {
+	MaxBytes      int64 // size of the whole playlist
+	MaxLines      int   // number of lines including blank ones
+	MaxLineLength int   // length of a single line in bytes
+	MaxSegments   int   // number of segments of a media playlist
+	MaxVariants   int   // number of variants of a master playlist
+	MaxAttributes int   // number of attributes in a single tag
+}
+
+// DecoderOptions configures a single decoding. Unlike the package
+// level TimeParse the options are not shared between decoders so
+// playlists from different sources may be decoded concurrently with
+// different settings.
+type DecoderOptions struct {
+	Strict         bool                                  // return the first syntax error
+	TimeParse      func(value string) (time.Time, error) // parser of EXT-X-PROGRAM-DATE-TIME, package TimeParse when nil
+	CustomDecoders []CustomDecoder                       // decoders of custom tags
+	Registry       *Registry                             // registry of custom tags used along with CustomDecoders
+	Limits         DecodeLimits                          // resource limits for untrusted input
+	BaseURI        string                                // relative URIs of segments, variants, renditions, keys and maps are resolved against it
+	Lines          LineIndex                             // filled with the source lines of the decoded objects when not nil
+}
+
+// LineIndex maps the decoded objects to the lines of the source where
+// they start, counting from 1. The keys are *MediaSegment (the line of
+// its EXTINF), *Variant, *Alternative and the tag names like
+// "#EXT-X-VERSION" for the first occurrence of the tag.
+type LineIndex map[interface{}]int
+
 // Decode parses a master playlist passed from the buffer. If `strict`
 // parameter is true then it returns first syntax error.
 func (p *MasterPlaylist) Decode(data bytes.Buffer, strict bool) error {
-	return p.decode(&data, strict)
+	return p.decode(&data, p.decoderOptions(strict))
 }
 
 // DecodeFrom parses a master playlist passed from the io.Reader
 // stream.  If `strict` parameter is true then it returns first syntax
 // error.
 func (p *MasterPlaylist) DecodeFrom(reader io.Reader, strict bool) error {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
+	return p.DecodeWithOptions(reader, *p.decoderOptions(strict))
+}
+
+// DecodeWithOptions parses a master playlist passed from the io.Reader
+// stream with the options. The decoders and limits set on the playlist
+// by WithCustomDecoders, WithRegistry and WithLimits are not used.
+func (p *MasterPlaylist) DecodeWithOptions(reader io.Reader, opts DecoderOptions) error {
+	buf, err := readLimited(reader, opts.Limits)
 	if err != nil {
 		return err
 	}
-	return p.decode(buf, strict)
+	return p.decode(buf, &opts)
 }
 
 // WithCustomDecoders adds custom tag decoders to the master playlist for decoding
@@ -60,27 +109,84 @@ func (p *MasterPlaylist) WithCustomDecoders(customDecoders []CustomDecoder) Play
 	return p
 }
 
+// WithRegistry attaches the registry of custom tags to the master
+// playlist. The tags registered at the moment of decoding are used
+// along with the decoders set by WithCustomDecoders.
+func (p *MasterPlaylist) WithRegistry(registry *Registry) Playlist {
+	// Create the map if it doesn't already exist
+	if p.Custom == nil {
+		p.Custom = make(map[string]CustomTag)
+	}
+
+	p.registry = registry
+
+	return p
+}
+
+// WithLimits sets the resource limits applied while decoding the master
+// playlist.
+func (p *MasterPlaylist) WithLimits(limits DecodeLimits) Playlist {
+	p.limits = limits
+	return p
+}
+
+// decoderOptions collects the options set on the playlist.
+func (p *MasterPlaylist) decoderOptions(strict bool) *DecoderOptions {
+	return &DecoderOptions{
+		Strict:         strict,
+		CustomDecoders: p.customDecoders,
+		Registry:       p.registry,
+		Limits:         p.limits,
+	}
+}
+
 // Parse master playlist. Internal function.
-func (p *MasterPlaylist) decode(buf *bytes.Buffer, strict bool) error {
-	var eof bool
+func (p *MasterPlaylist) decode(buf *bytes.Buffer, opts *DecoderOptions) error {
+	return p.decodeWithState(buf.String(), opts, new(decodingState))
+}
 
-	state := new(decodingState)
+func (p *MasterPlaylist) decodeWithState(data string, opts *DecoderOptions, state *decodingState) error {
+	var (
+		line   string
+		found  = true
+		strict = opts.Strict
+	)
 
-	for !eof {
-		line, err := buf.ReadString('\n')
-		if err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
+	state.listType = MASTER
+	if err := state.init(data, opts); err != nil {
+		return err
+	}
+	if state.decoders != nil && p.Custom == nil {
+		p.Custom = make(map[string]CustomTag)
+	}
+
+	for found {
+		line, data, found = strings.Cut(data, "\n")
+		if err := state.checkLine(line, !found); err != nil {
+			return err
 		}
-		err = decodeLineOfMasterPlaylist(p, state, line, strict)
-		if strict && err != nil {
+		// fixes the issues https://github.com/grafov/m3u8/issues/25
+		if state.skipEmpty && isEmptyLine(line) {
+			continue
+		}
+		err := decodeLineOfMasterPlaylist(p, state, line, strict)
+		if err != nil && (strict || errors.Is(err, ErrLimitExceeded)) {
 			return err
 		}
 	}
 
 	p.attachRenditionsToVariants(state.alternatives)
 
+	// variant tags without variant after them are left to the playlist
+	if state.tagCustom {
+		custom, order := state.takeCustomTags()
+		for _, name := range order {
+			for _, t := range CustomTags(custom, name) {
+				addCustomTag(&p.Custom, &p.customOrder, name, t)
+			}
+		}
+	}
+
 	if strict && !state.m3u {
 		return errors.New("#EXTM3U absent")
 	}
@@ -112,19 +218,25 @@ func (p *MasterPlaylist) attachRenditionsToVariants(alternatives []*Alternative)
 // Decode parses a media playlist passed from the buffer. If `strict`
 // parameter is true then return first syntax error.
 func (p *MediaPlaylist) Decode(data bytes.Buffer, strict bool) error {
-	return p.decode(&data, strict)
+	return p.decode(&data, p.decoderOptions(strict))
 }
 
 // DecodeFrom parses a media playlist passed from the io.Reader
 // stream. If `strict` parameter is true then it returns first syntax
 // error.
 func (p *MediaPlaylist) DecodeFrom(reader io.Reader, strict bool) error {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
+	return p.DecodeWithOptions(reader, *p.decoderOptions(strict))
+}
+
+// DecodeWithOptions parses a media playlist passed from the io.Reader
+// stream with the options. The decoders and limits set on the playlist
+// by WithCustomDecoders, WithRegistry and WithLimits are not used.
+func (p *MediaPlaylist) DecodeWithOptions(reader io.Reader, opts DecoderOptions) error {
+	buf, err := readLimited(reader, opts.Limits)
 	if err != nil {
 		return err
 	}
-	return p.decode(buf, strict)
+	return p.decode(buf, &opts)
 }
 
 // WithCustomDecoders adds custom tag decoders to the media playlist for decoding
@@ -139,29 +251,84 @@ func (p *MediaPlaylist) WithCustomDecoders(customDecoders []CustomDecoder) Playl
 	return p
 }
 
-func (p *MediaPlaylist) decode(buf *bytes.Buffer, strict bool) error {
-	var eof bool
-	var line string
-	var err error
+// WithRegistry attaches the registry of custom tags to the media
+// playlist. The tags registered at the moment of decoding are used
+// along with the decoders set by WithCustomDecoders.
+func (p *MediaPlaylist) WithRegistry(registry *Registry) Playlist {
+	// Create the map if it doesn't already exist
+	if p.Custom == nil {
+		p.Custom = make(map[string]CustomTag)
+	}
 
-	state := new(decodingState)
-	wv := new(WV)
+	p.registry = registry
 
-	for !eof {
-		if line, err = buf.ReadString('\n'); err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
-		}
+	return p
+}
 
-		err = decodeLineOfMediaPlaylist(p, wv, state, line, strict)
-		if strict && err != nil {
+// WithLimits sets the resource limits applied while decoding the media
+// playlist.
+func (p *MediaPlaylist) WithLimits(limits DecodeLimits) Playlist {
+	p.limits = limits
+	return p
+}
+
+// decoderOptions collects the options set on the playlist.
+func (p *MediaPlaylist) decoderOptions(strict bool) *DecoderOptions {
+	return &DecoderOptions{
+		Strict:         strict,
+		CustomDecoders: p.customDecoders,
+		Registry:       p.registry,
+		Limits:         p.limits,
+	}
+}
+
+func (p *MediaPlaylist) decode(buf *bytes.Buffer, opts *DecoderOptions) error {
+	return p.decodeWithState(buf.String(), opts, new(decodingState))
+}
+
+// decodeWithState walks over the lines of the input. The input is
+// converted to a string once and lines are sliced from it, so the
+// line handling itself doesn't allocate. The segments are counted
+// beforehand by their EXTINF tags to size the ring buffer and to
+// allocate the segments in one block.
+func (p *MediaPlaylist) decodeWithState(data string, opts *DecoderOptions, state *decodingState) error {
+	var (
+		line   string
+		found  = true
+		strict = opts.Strict
+	)
+
+	state.listType = MEDIA
+	state.wv = new(WV)
+	if err := state.init(data, opts); err != nil {
+		return err
+	}
+	state.expected = strings.Count(data, "#EXTINF")
+	if max := state.limits.MaxSegments; max > 0 && state.expected > max {
+		// don't allocate more than the limit of segments allows
+		state.expected = max
+	}
+	p.grow(uint(state.expected))
+	if state.decoders != nil && p.Custom == nil {
+		p.Custom = make(map[string]CustomTag)
+	}
+
+	for found {
+		line, data, found = strings.Cut(data, "\n")
+		if err := state.checkLine(line, !found); err != nil {
+			return err
+		}
+		// fixes the issues https://github.com/grafov/m3u8/issues/25
+		if state.skipEmpty && isEmptyLine(line) {
+			continue
+		}
+		err := decodeLineOfMediaPlaylist(p, state, line, strict)
+		if err != nil && (strict || errors.Is(err, ErrLimitExceeded)) {
 			return err
 		}
-
 	}
 	if state.tagWV {
-		p.WV = wv
+		p.WV = state.wv
 	}
 	if strict && !state.m3u {
 		return errors.New("#EXTM3U absent")
@@ -172,109 +339,302 @@ func (p *MediaPlaylist) decode(buf *bytes.Buffer, strict bool) error {
 // Decode detects type of playlist and decodes it. It accepts bytes
 // buffer as input.
 func Decode(data bytes.Buffer, strict bool) (Playlist, ListType, error) {
-	return decode(&data, strict, nil)
+	return decode(&data, &DecoderOptions{Strict: strict})
 }
 
 // DecodeFrom detects type of playlist and decodes it. It accepts data
 // conformed with io.Reader.
 func DecodeFrom(reader io.Reader, strict bool) (Playlist, ListType, error) {
-	buf := new(bytes.Buffer)
-	_, err := buf.ReadFrom(reader)
-	if err != nil {
-		return nil, 0, err
-	}
-	return decode(buf, strict, nil)
+	return DecodeWithOptions(reader, DecoderOptions{Strict: strict})
 }
 
 // DecodeWith detects the type of playlist and decodes it. It accepts either bytes.Buffer
 // or io.Reader as input. Any custom decoders provided will be used during decoding.
 func DecodeWith(input interface{}, strict bool, customDecoders []CustomDecoder) (Playlist, ListType, error) {
+	return DecodeWithLimits(input, strict, customDecoders, DecodeLimits{})
+}
+
+// DecodeWithLimits works like DecodeWith but stops decoding with one of
+// the ErrLimitExceeded errors as soon as the input exceeds the limits.
+// Use it for playlists which come from untrusted sources.
+func DecodeWithLimits(input interface{}, strict bool, customDecoders []CustomDecoder, limits DecodeLimits) (Playlist, ListType, error) {
+	opts := DecoderOptions{Strict: strict, CustomDecoders: customDecoders, Limits: limits}
 	switch v := input.(type) {
 	case bytes.Buffer:
-		return decode(&v, strict, customDecoders)
+		return decode(&v, &opts)
 	case io.Reader:
-		buf := new(bytes.Buffer)
-		_, err := buf.ReadFrom(v)
-		if err != nil {
-			return nil, 0, err
-		}
-		return decode(buf, strict, customDecoders)
+		return DecodeWithOptions(v, opts)
 	default:
 		return nil, 0, errors.New("input must be bytes.Buffer or io.Reader type")
 	}
 }
 
+// DecodeWithOptions detects type of playlist and decodes it with the
+// options.
+func DecodeWithOptions(reader io.Reader, opts DecoderOptions) (Playlist, ListType, error) {
+	buf, err := readLimited(reader, opts.Limits)
+	if err != nil {
+		return nil, 0, err
+	}
+	return decode(buf, &opts)
+}
+
 // Detect playlist type and decode it. May be used as decoder for both
-// master and media playlists.
-func decode(buf *bytes.Buffer, strict bool, customDecoders []CustomDecoder) (Playlist, ListType, error) {
-	var eof bool
-	var line string
-	var master *MasterPlaylist
-	var media *MediaPlaylist
-	var listType ListType
-	var err error
+// master and media playlists. The type is sniffed from the first
+// decisive tag so only the matching decoder passes over the input.
+func decode(buf *bytes.Buffer, opts *DecoderOptions) (Playlist, ListType, error) {
+	data := buf.String()
+	listType, m3u := detectListType(data)
+	switch listType {
+	case MASTER:
+		master := NewMasterPlaylist()
+		if err := master.decodeWithState(data, opts, &decodingState{skipEmpty: true}); err != nil {
+			return master, MASTER, err
+		}
+		return master, MASTER, nil
+	case MEDIA:
+		media, err := NewMediaPlaylist(8, 1024) // Winsize for VoD will become 0, capacity auto extends
+		if err != nil {
+			return nil, 0, fmt.Errorf("create media playlist failed: %s", err)
+		}
+		if err = media.decodeWithState(data, opts, &decodingState{skipEmpty: true}); err != nil {
+			return media, MEDIA, err
+		}
+		if media.Closed || media.MediaType == EVENT {
+			// VoD and Event's should show the entire playlist
+			media.SetWinSize(0)
+		}
+		return media, MEDIA, nil
+	}
+	if opts.Strict && !m3u {
+		return nil, 0, errors.New("#EXTM3U absent")
+	}
+	return nil, 0, errors.New("can't detect playlist type")
+}
 
-	state := new(decodingState)
-	wv := new(WV)
+// init prepares the decoding state accordingly with the options.
+func (s *decodingState) init(data string, opts *DecoderOptions) error {
+	s.decoders = indexCustomDecoders(opts.Registry.Decoders(), opts.CustomDecoders)
+	s.limits = opts.Limits
+	s.lineIndex = opts.Lines
+	s.timeParse = opts.TimeParse
+	if s.timeParse == nil {
+		s.timeParse = TimeParse
+	}
+	if opts.BaseURI != "" {
+		base, err := url.Parse(opts.BaseURI)
+		if err != nil {
+			return fmt.Errorf("invalid base URI: %w", err)
+		}
+		s.baseURI = base
+	}
+	return s.checkSize(data)
+}
 
-	master = NewMasterPlaylist()
-	media, err = NewMediaPlaylist(8, 1024) // Winsize for VoD will become 0, capacity auto extends
+// resolveURI resolves the URI against the base URI if it was set.
+func (s *decodingState) resolveURI(uri string) string {
+	if s.baseURI == nil || uri == "" {
+		return uri
+	}
+	ref, err := url.Parse(uri)
 	if err != nil {
-		return nil, 0, fmt.Errorf("create media playlist failed: %s", err)
+		return uri
 	}
+	return s.baseURI.ResolveReference(ref).String()
+}
 
-	// If we have custom tags to parse
-	if customDecoders != nil {
-		media = media.WithCustomDecoders(customDecoders).(*MediaPlaylist)
-		master = master.WithCustomDecoders(customDecoders).(*MasterPlaylist)
-		state.custom = make(map[string]CustomTag)
+// readLimited reads the whole input but no more than the limit of
+// bytes allows.
+func readLimited(reader io.Reader, limits DecodeLimits) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	if limits.MaxBytes > 0 {
+		reader = io.LimitReader(reader, limits.MaxBytes+1)
 	}
+	if _, err := buf.ReadFrom(reader); err != nil {
+		return nil, err
+	}
+	if limits.MaxBytes > 0 && int64(buf.Len()) > limits.MaxBytes {
+		return nil, ErrTooManyBytes
+	}
+	return buf, nil
+}
 
-	for !eof {
-		if line, err = buf.ReadString('\n'); err == io.EOF {
-			eof = true
-		} else if err != nil {
-			break
-		}
+// checkSize checks the size of the whole input against the limits.
+func (s *decodingState) checkSize(data string) error {
+	if s.limits.MaxBytes > 0 && int64(len(data)) > s.limits.MaxBytes {
+		return ErrTooManyBytes
+	}
+	return nil
+}
 
-		// fixes the issues https://github.com/grafov/m3u8/issues/25
-		// TODO: the same should be done in decode functions of both Master- and MediaPlaylists
-		// so some DRYing would be needed.
-		if len(line) < 1 || line == "\r" {
+// checkLine counts the line and checks it against the limits. The
+// empty remainder after the final line break is not a line.
+func (s *decodingState) checkLine(line string, last bool) error {
+	if last && line == "" {
+		return nil
+	}
+	s.lines++
+	if s.limits.MaxLines > 0 && s.lines > s.limits.MaxLines {
+		return ErrTooManyLines
+	}
+	if s.limits.MaxLineLength > 0 && len(line) > s.limits.MaxLineLength {
+		return ErrLineTooLong
+	}
+	return nil
+}
+
+// minSegmentsBlock is the least number of segments allocated at once
+// when the EXTINF tags were miscounted.
+const minSegmentsBlock = 16
+
+// newSegment returns a new segment. The segments are allocated in
+// blocks for the expected number of segments instead of one by one.
+func (s *decodingState) newSegment() *MediaSegment {
+	if s.next == len(s.segments) {
+		n := s.expected - s.allocated
+		if n < minSegmentsBlock {
+			n = minSegmentsBlock
+		}
+		s.segments, s.next = make([]MediaSegment, n), 0
+		s.allocated += n
+	}
+	s.next++
+	return &s.segments[s.next-1]
+}
+
+// addLine records the line of the decoded object or tag in the line
+// index if it was requested. The first line is kept for the repeated
+// tags.
+func (s *decodingState) addLine(key interface{}, line int) {
+	if s.lineIndex == nil {
+		return
+	}
+	if _, ok := s.lineIndex[key]; !ok {
+		s.lineIndex[key] = line
+	}
+}
+
+// isEmptyLine reports whether the line has no content except the line
+// terminator.
+func isEmptyLine(line string) bool {
+	return line == "" || line == "\r"
+}
+
+// Tags which may appear only in one type of playlist. EXT-X-VERSION,
+// EXT-X-START and EXT-X-INDEPENDENT-SEGMENTS are allowed in both so they
+// can't be used for detection. Widevine tags are detected by the prefix.
+var (
+	masterOnlyTags = map[string]bool{
+		"#EXT-X-STREAM-INF":         true,
+		"#EXT-X-I-FRAME-STREAM-INF": true,
+		"#EXT-X-MEDIA":              true,
+		"#EXT-X-SESSION-DATA":       true,
+		"#EXT-X-SESSION-KEY":        true,
+	}
+	mediaOnlyTags = map[string]bool{
+		"#EXTINF":                  true,
+		"#EXT-X-TARGETDURATION":    true,
+		"#EXT-X-MEDIA-SEQUENCE":    true,
+		"#EXT-X-DISCONTINUITY":     true,
+		"#EXT-X-ENDLIST":           true,
+		"#EXT-X-PLAYLIST-TYPE":     true,
+		"#EXT-X-I-FRAMES-ONLY":     true,
+		"#EXT-X-KEY":               true,
+		"#EXT-X-MAP":               true,
+		"#EXT-X-PROGRAM-DATE-TIME": true,
+		"#EXT-X-BYTERANGE":         true,
+		"#EXT-SCTE35":              true,
+	}
+)
+
+// detectListType looks for the first tag that may appear only in one
+// type of playlist. It also reports whether #EXTM3U header was seen
+// before the decisive tag.
+func detectListType(data string) (ListType, bool) {
+	var (
+		line  string
+		m3u   bool
+		found = true
+	)
+	for found {
+		line, data, found = strings.Cut(data, "\n")
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] != '#' {
 			continue
 		}
-
-		err = decodeLineOfMasterPlaylist(master, state, line, strict)
-		master.attachRenditionsToVariants(state.alternatives)
-		if strict && err != nil {
-			return master, state.listType, err
+		name, _ := splitTag(line)
+		switch {
+		case name == "#EXTM3U":
+			m3u = true
+		case masterOnlyTags[name]:
+			return MASTER, m3u
+		case mediaOnlyTags[name], strings.HasPrefix(name, "#WV-"):
+			return MEDIA, m3u
 		}
+	}
+	return 0, m3u
+}
 
-		err = decodeLineOfMediaPlaylist(media, wv, state, line, strict)
-		if strict && err != nil {
-			return media, state.listType, err
+// splitTag splits the tag line to the tag name and its value. The name
+// ends at the first ':' or at the first space for Widevine tags which
+// don't use a colon.
+func splitTag(line string) (name, value string) {
+	for i := 0; i < len(line); i++ {
+		if line[i] == ':' || line[i] == ' ' {
+			return line[:i], line[i+1:]
 		}
-
 	}
-	if state.listType == MEDIA && state.tagWV {
-		media.WV = wv
+	return line, ""
+}
+
+// indexCustomDecoders groups custom decoders by their tag names so the
+// decoders for a line are found with a single lookup.
+func indexCustomDecoders(decoderLists ...[]CustomDecoder) map[string][]CustomDecoder {
+	var index map[string][]CustomDecoder
+	for _, customDecoders := range decoderLists {
+		for _, v := range customDecoders {
+			if index == nil {
+				index = make(map[string][]CustomDecoder)
+			}
+			name, _ := splitTag(v.TagName())
+			index[name] = append(index[name], v)
+		}
 	}
+	return index
+}
 
-	if strict && !state.m3u {
-		return nil, listType, errors.New("#EXTM3U absent")
+// decodeKey fills the key from the attributes of EXT-X-KEY.
+func decodeKey(key *Key, attrs AttributeList) {
+	for _, a := range attrs {
+		switch a.Name {
+		case "METHOD":
+			key.Method = a.Value
+		case "URI":
+			key.URI = a.Value
+		case "IV":
+			key.IV = a.Value
+		case "KEYFORMAT":
+			key.Keyformat = a.Value
+		case "KEYFORMATVERSIONS":
+			key.Keyformatversions = a.Value
+		}
 	}
+}
 
-	switch state.listType {
-	case MASTER:
-		return master, MASTER, nil
-	case MEDIA:
-		if media.Closed || media.MediaType == EVENT {
-			// VoD and Event's should show the entire playlist
-			media.SetWinSize(0)
+// decodeMap fills the map from the attributes of EXT-X-MAP.
+func decodeMap(m *Map, attrs AttributeList) error {
+	var err error
+	for _, a := range attrs {
+		switch a.Name {
+		case "URI":
+			m.URI = a.Value
+		case "BYTERANGE":
+			if m.Limit, m.Offset, err = a.ByteRange(); err != nil {
+				err = fmt.Errorf("byterange sub-range length value parsing error: %s", err)
+			}
 		}
-		return media, MEDIA, nil
 	}
-	return nil, state.listType, errors.New("can't detect playlist type")
+	return err
 }
 
 // DecodeAttributeList turns an attribute list into a key, value map. You should trim
@@ -283,577 +643,756 @@ func DecodeAttributeList(line string) map[string]string {
 	return decodeParamsLine(line)
 }
 
-func decodeParamsLine(line string) map[string]string {
-	out := make(map[string]string)
-	for _, kv := range reKeyValue.FindAllStringSubmatch(line, -1) {
-		k, v := kv[1], kv[2]
-		out[k] = strings.Trim(v, ` "`)
+// decodeAttributes decodes the attribute list of a tag obeying the
+// limit of attributes per tag. Syntax errors are tolerated, the
+// attributes which could be decoded are returned.
+func (s *decodingState) decodeAttributes(value string) (AttributeList, error) {
+	attrs, err := parseAttributeList(value, s.limits.MaxAttributes)
+	if err == ErrTooManyAttributes {
+		return nil, err
 	}
-	return out
+	return attrs, nil
+}
+
+func decodeParamsLine(line string) map[string]string {
+	attrs, _ := parseAttributeList(line, 0)
+	return attrs.Map()
 }
 
+// masterTagDecoder decodes the value of a single master playlist tag.
+type masterTagDecoder func(p *MasterPlaylist, state *decodingState, value string, strict bool) error
+
+// mediaTagDecoder decodes the value of a single media playlist tag.
+type mediaTagDecoder func(p *MediaPlaylist, state *decodingState, value string, strict bool) error
+
 // Parse one line of master playlist.
 func decodeLineOfMasterPlaylist(p *MasterPlaylist, state *decodingState, line string, strict bool) error {
-	var err error
-
 	line = strings.TrimSpace(line)
 
-	// check for custom tags first to allow custom parsing of existing tags
-	if p.Custom != nil {
-		for _, v := range p.customDecoders {
-			if strings.HasPrefix(line, v.TagName()) {
-				t, err := v.Decode(line)
+	if len(line) == 0 || line[0] != '#' {
+		if state.tagStreamInf {
+			state.tagStreamInf = false
+			state.variant.URI = state.resolveURI(line)
+		}
+		return nil
+	}
 
-				if strict && err != nil {
-					return err
-				}
+	name, value := splitTag(line)
+	if state.lineIndex != nil {
+		state.addLine(name, state.lines)
+	}
 
-				p.Custom[t.TagName()] = t
+	// check for custom tags first to allow custom parsing of existing tags
+	var replaced bool
+	if p.Custom != nil {
+		for _, v := range state.decoders[name] {
+			var (
+				t   CustomTag
+				err error
+			)
+			if cd, ok := v.(ContextDecoder); ok {
+				ctx := &DecodingContext{Line: state.lines, Strict: strict, Master: p, SegmentTags: state.custom}
+				t, err = cd.DecodeWithContext(ctx, line)
+				replaced = replaced || cd.Mode() == DecodeReplace
+			} else {
+				t, err = v.Decode(line)
+			}
+			if strict && err != nil {
+				return err
+			}
+			if t == nil {
+				continue
+			}
+			if vt, ok := v.(VariantTagDecoder); ok && vt.VariantTag() {
+				state.tagCustom = true
+				addCustomTag(&state.custom, &state.customOrder, t.TagName(), t)
+			} else {
+				addCustomTag(&p.Custom, &p.customOrder, t.TagName(), t)
 			}
 		}
 	}
+	if replaced {
+		return nil
+	}
+
+	if decodeTag, ok := masterTagDecoders[name]; ok {
+		return decodeTag(p, state, value, strict)
+	}
+	// comments and unknown tags are ignored
+	return nil
+}
 
-	switch {
-	case line == "#EXTM3U": // start tag first
+var masterTagDecoders = map[string]masterTagDecoder{
+	"#EXTM3U": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
 		state.m3u = true
-	case strings.HasPrefix(line, "#EXT-X-VERSION:"): // version tag
-		state.listType = MASTER
-		_, err = fmt.Sscanf(line, "#EXT-X-VERSION:%d", &p.ver)
-		if strict && err != nil {
+		return nil
+	},
+	"#EXT-X-VERSION": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
+		ver, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
 			return err
 		}
-	case line == "#EXT-X-INDEPENDENT-SEGMENTS":
+		p.ver = uint8(ver)
+		return nil
+	},
+	"#EXT-X-INDEPENDENT-SEGMENTS": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
 		p.SetIndependentSegments(true)
-	case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+		return nil
+	},
+	"#EXT-X-MEDIA": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
 		var alt Alternative
-		state.listType = MASTER
-		for k, v := range decodeParamsLine(line[13:]) {
-			switch k {
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			switch a.Name {
 			case "TYPE":
-				alt.Type = v
+				alt.Type = a.Value
 			case "GROUP-ID":
-				alt.GroupId = v
+				alt.GroupId = a.Value
 			case "LANGUAGE":
-				alt.Language = v
+				alt.Language = a.Value
 			case "NAME":
-				alt.Name = v
+				alt.Name = a.Value
 			case "DEFAULT":
-				if strings.ToUpper(v) == "YES" {
-					alt.Default = true
-				} else if strings.ToUpper(v) == "NO" {
-					alt.Default = false
-				} else if strict {
-					return errors.New("value must be YES or NO")
+				if alt.Default, err = a.Bool(); strict && err != nil {
+					return err
 				}
 			case "AUTOSELECT":
-				alt.Autoselect = v
+				alt.Autoselect = a.Value
 			case "FORCED":
-				alt.Forced = v
+				alt.Forced = a.Value
 			case "CHARACTERISTICS":
-				alt.Characteristics = v
+				alt.Characteristics = a.Value
 			case "SUBTITLES":
-				alt.Subtitles = v
+				alt.Subtitles = a.Value
 			case "URI":
-				alt.URI = v
+				alt.URI = state.resolveURI(a.Value)
 			}
 		}
+		if state.tagCustom {
+			alt.Custom, alt.customOrder = state.takeCustomTags()
+		}
 		state.alternatives = append(state.alternatives, &alt)
-	case !state.tagStreamInf && strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+		state.addLine(&alt, state.lines)
+		return nil
+	},
+	"#EXT-X-STREAM-INF": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
+		if state.tagStreamInf {
+			return nil
+		}
 		state.tagStreamInf = true
-		state.listType = MASTER
+		if max := state.limits.MaxVariants; max > 0 && len(p.Variants) >= max {
+			return ErrTooManyVariants
+		}
 		state.variant = new(Variant)
+		if state.tagCustom {
+			state.variant.Custom, state.variant.customOrder = state.takeCustomTags()
+		}
 		p.Variants = append(p.Variants, state.variant)
-		for k, v := range decodeParamsLine(line[18:]) {
-			switch k {
+		state.addLine(state.variant, state.lines)
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			switch a.Name {
 			case "PROGRAM-ID":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.ProgramId = uint32(val)
 			case "BANDWIDTH":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.Bandwidth = uint32(val)
 			case "CODECS":
-				state.variant.Codecs = v
+				state.variant.Codecs = a.Value
 			case "RESOLUTION":
-				state.variant.Resolution = v
+				state.variant.Resolution = a.Value
 			case "AUDIO":
-				state.variant.Audio = v
+				state.variant.Audio = a.Value
 			case "VIDEO":
-				state.variant.Video = v
+				state.variant.Video = a.Value
 			case "SUBTITLES":
-				state.variant.Subtitles = v
+				state.variant.Subtitles = a.Value
 			case "CLOSED-CAPTIONS":
-				state.variant.Captions = v
+				state.variant.Captions = a.Value
 			case "NAME":
-				state.variant.Name = v
+				state.variant.Name = a.Value
 			case "AVERAGE-BANDWIDTH":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.AverageBandwidth = uint32(val)
 			case "FRAME-RATE":
-				if state.variant.FrameRate, err = strconv.ParseFloat(v, 64); strict && err != nil {
+				if state.variant.FrameRate, err = a.Float(); strict && err != nil {
 					return err
 				}
 			case "VIDEO-RANGE":
-				state.variant.VideoRange = v
+				state.variant.VideoRange = a.Value
 			case "HDCP-LEVEL":
-				state.variant.HDCPLevel = v
+				state.variant.HDCPLevel = a.Value
+			case "STABLE-VARIANT-ID":
+				state.variant.StableVariantId = a.Value
 			}
 		}
-	case state.tagStreamInf && !strings.HasPrefix(line, "#"):
-		state.tagStreamInf = false
-		state.variant.URI = line
-	case strings.HasPrefix(line, "#EXT-X-I-FRAME-STREAM-INF:"):
-		state.listType = MASTER
+		return err
+	},
+	"#EXT-X-I-FRAME-STREAM-INF": func(p *MasterPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
+		if max := state.limits.MaxVariants; max > 0 && len(p.Variants) >= max {
+			return ErrTooManyVariants
+		}
 		state.variant = new(Variant)
 		state.variant.Iframe = true
-		if len(state.alternatives) > 0 {
-			state.variant.Alternatives = state.alternatives
-			state.alternatives = nil
+		if state.tagCustom {
+			state.variant.Custom, state.variant.customOrder = state.takeCustomTags()
 		}
 		p.Variants = append(p.Variants, state.variant)
-		for k, v := range decodeParamsLine(line[26:]) {
-			switch k {
+		state.addLine(state.variant, state.lines)
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			switch a.Name {
 			case "URI":
-				state.variant.URI = v
+				state.variant.URI = state.resolveURI(a.Value)
 			case "PROGRAM-ID":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.ProgramId = uint32(val)
 			case "BANDWIDTH":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.Bandwidth = uint32(val)
 			case "CODECS":
-				state.variant.Codecs = v
+				state.variant.Codecs = a.Value
 			case "RESOLUTION":
-				state.variant.Resolution = v
+				state.variant.Resolution = a.Value
 			case "AUDIO":
-				state.variant.Audio = v
+				state.variant.Audio = a.Value
 			case "VIDEO":
-				state.variant.Video = v
+				state.variant.Video = a.Value
 			case "AVERAGE-BANDWIDTH":
-				var val int
-				val, err = strconv.Atoi(v)
+				var val int64
+				val, err = a.Int()
 				if strict && err != nil {
 					return err
 				}
 				state.variant.AverageBandwidth = uint32(val)
 			case "VIDEO-RANGE":
-				state.variant.VideoRange = v
+				state.variant.VideoRange = a.Value
 			case "HDCP-LEVEL":
-				state.variant.HDCPLevel = v
+				state.variant.HDCPLevel = a.Value
+			case "STABLE-VARIANT-ID":
+				state.variant.StableVariantId = a.Value
 			}
 		}
-	case strings.HasPrefix(line, "#"):
-		// comments are ignored
-	}
-	return err
+		return err
+	},
 }
 
 // Parse one line of media playlist.
-func decodeLineOfMediaPlaylist(p *MediaPlaylist, wv *WV, state *decodingState, line string, strict bool) error {
-	var err error
-
+func decodeLineOfMediaPlaylist(p *MediaPlaylist, state *decodingState, line string, strict bool) error {
 	line = strings.TrimSpace(line)
 
-	// check for custom tags first to allow custom parsing of existing tags
-	if p.Custom != nil {
-		for _, v := range p.customDecoders {
-			if strings.HasPrefix(line, v.TagName()) {
-				t, err := v.Decode(line)
-
-				if strict && err != nil {
-					return err
-				}
+	if len(line) == 0 || line[0] != '#' {
+		return decodeSegmentURI(p, state, line, strict)
+	}
 
-				if v.SegmentTag() {
-					state.tagCustom = true
-					state.custom[v.TagName()] = t
-				} else {
-					p.Custom[v.TagName()] = t
-				}
-			}
-		}
+	name, value := splitTag(line)
+	if state.lineIndex != nil {
+		state.addLine(name, state.lines)
 	}
 
-	switch {
-	case !state.tagInf && strings.HasPrefix(line, "#EXTINF:"):
-		state.tagInf = true
-		state.listType = MEDIA
-		sepIndex := strings.Index(line, ",")
-		if sepIndex == -1 {
-			if strict {
-				return fmt.Errorf("could not parse: %q", line)
+	// check for custom tags first to allow custom parsing of existing tags
+	var replaced bool
+	if p.Custom != nil {
+		for _, v := range state.decoders[name] {
+			var (
+				t   CustomTag
+				err error
+			)
+			if cd, ok := v.(ContextDecoder); ok {
+				t, err = cd.DecodeWithContext(mediaDecodingContext(p, state, strict), line)
+				replaced = replaced || cd.Mode() == DecodeReplace
+			} else {
+				t, err = v.Decode(line)
 			}
-			sepIndex = len(line)
-		}
-		duration := line[8:sepIndex]
-		if len(duration) > 0 {
-			if state.duration, err = strconv.ParseFloat(duration, 64); strict && err != nil {
-				return fmt.Errorf("duration parsing error: %s", err)
+			if strict && err != nil {
+				return err
 			}
-		}
-		if len(line) > sepIndex {
-			state.title = line[sepIndex+1:]
-		}
-	case !strings.HasPrefix(line, "#"):
-		if state.tagInf {
-			err := p.Append(line, state.duration, state.title)
-			if err == ErrPlaylistFull {
-				// Extend playlist by doubling size, reset internal state, try again.
-				// If the second Append fails, the if err block will handle it.
-				// Retrying instead of being recursive was chosen as the state maybe
-				// modified non-idempotently.
-				p.Segments = append(p.Segments, make([]*MediaSegment, p.Count())...)
-				p.capacity = uint(len(p.Segments))
-				p.tail = p.count
-				err = p.Append(line, state.duration, state.title)
+			if t == nil {
+				continue
 			}
-			// Check err for first or subsequent Append()
-			if err != nil {
-				return err
+			if v.SegmentTag() {
+				state.tagCustom = true
+				addCustomTag(&state.custom, &state.customOrder, v.TagName(), t)
+			} else {
+				addCustomTag(&p.Custom, &p.customOrder, v.TagName(), t)
 			}
-			state.tagInf = false
 		}
-		if state.tagRange {
-			if err = p.SetRange(state.limit, state.offset); strict && err != nil {
-				return err
+	}
+	if replaced {
+		return nil
+	}
+
+	if decodeTag, ok := mediaTagDecoders[name]; ok {
+		return decodeTag(p, state, value, strict)
+	}
+	// comments and unknown tags are ignored
+	return nil
+}
+
+// takeCustomTags returns custom tags collected for the next segment,
+// variant or rendition and resets them.
+func (s *decodingState) takeCustomTags() (map[string]CustomTag, []string) {
+	custom, order := s.custom, s.customOrder
+	s.custom, s.customOrder, s.tagCustom = nil, nil, false
+	return custom, order
+}
+
+// mediaDecodingContext describes the current state of media playlist
+// decoding for ContextDecoder.
+func mediaDecodingContext(p *MediaPlaylist, state *decodingState, strict bool) *DecodingContext {
+	ctx := &DecodingContext{
+		Line:         state.lines,
+		Strict:       strict,
+		Media:        p,
+		SegmentSeqId: p.SeqNo,
+		SegmentTags:  state.custom,
+	}
+	if p.Count() > 0 {
+		ctx.PrevSegment = p.Segments[p.last()]
+		ctx.SegmentSeqId = ctx.PrevSegment.SeqId + 1
+	}
+	return ctx
+}
+
+// decodeSegmentURI appends a new segment for the URI line and links
+// all the tags collected since the previous segment to it.
+func decodeSegmentURI(p *MediaPlaylist, state *decodingState, uri string, strict bool) error {
+	var err error
+
+	uri = state.resolveURI(uri)
+	if state.tagInf {
+		max := uint(state.limits.MaxSegments)
+		if max > 0 && p.Count() >= max {
+			return ErrTooManySegments
+		}
+		if p.count == p.capacity {
+			// the estimate was short, extend playlist by doubling size
+			grow := p.count
+			if max > 0 && p.count+grow > max {
+				// don't allocate more than the limit of segments allows
+				grow = max - p.count
 			}
-			state.tagRange = false
-		}
-		if state.tagSCTE35 {
-			state.tagSCTE35 = false
-			if err = p.SetSCTE35(state.scte); strict && err != nil {
-				return err
+			if grow == 0 {
+				grow = 1
 			}
+			p.grow(grow)
+		}
+		seg := state.newSegment()
+		seg.URI = uri
+		seg.Duration = state.duration
+		seg.Title = state.title
+		err := p.AppendSegment(seg)
+		// Check err for first or subsequent Append()
+		if err != nil {
+			return err
 		}
-		if state.tagDiscontinuity != nil {
-			if err = p.SetDiscontinuity(*state.tagDiscontinuity); strict && err != nil {
-				return err
-			}
-			state.tagDiscontinuity = nil
+		state.addLine(p.Segments[p.last()], state.infLine)
+		state.tagInf = false
+	}
+	if state.tagRange {
+		// the range is set directly, unlike SetRange the decoder keeps
+		// the declared version so Validate can check it
+		if p.count > 0 {
+			seg := p.Segments[p.last()]
+			seg.Limit, seg.Offset = state.limit, state.offset
+		} else if strict {
+			return errors.New("playlist is empty")
+		}
+		state.tagRange = false
+	}
+	if state.tagSCTE35 {
+		state.tagSCTE35 = false
+		if err = p.SetSCTE35(state.scte); strict && err != nil {
+			return err
 		}
-		if state.tagProgramDateTime && p.Count() > 0 {
-			state.tagProgramDateTime = false
-			if err = p.SetProgramDateTime(state.programDateTime); strict && err != nil {
-				return err
-			}
+	}
+	if state.tagDiscontinuity != nil {
+		if err = p.SetDiscontinuity(*state.tagDiscontinuity); strict && err != nil {
+			return err
 		}
-		// If EXT-X-KEY appeared before reference to segment (EXTINF) then it linked to this segment
-		if state.tagKey {
-			p.Segments[p.last()].Key = &Key{state.xkey.Method, state.xkey.URI, state.xkey.IV, state.xkey.Keyformat, state.xkey.Keyformatversions}
-			// First EXT-X-KEY may appeared in the header of the playlist and linked to first segment
-			// but for convenient playlist generation it also linked as default playlist key
-			if p.Key == nil {
-				p.Key = state.xkey
-			}
-			state.tagKey = false
-		}
-		// If EXT-X-MAP appeared before reference to segment (EXTINF) then it linked to this segment
-		if state.tagMap {
-			p.Segments[p.last()].Map = &Map{state.xmap.URI, state.xmap.Limit, state.xmap.Offset}
-			// First EXT-X-MAP may appeared in the header of the playlist and linked to first segment
-			// but for convenient playlist generation it also linked as default playlist map
-			if p.Map == nil {
-				p.Map = state.xmap
-			}
-			state.tagMap = false
+		state.tagDiscontinuity = nil
+	}
+	if state.tagProgramDateTime && p.Count() > 0 {
+		state.tagProgramDateTime = false
+		if err = p.SetProgramDateTime(state.programDateTime); strict && err != nil {
+			return err
 		}
+	}
+	// If EXT-X-KEY appeared before reference to segment (EXTINF) then it linked to this segment
+	if state.tagKey && p.Count() > 0 {
+		p.Segments[p.last()].Key = &Key{state.xkey.Method, state.xkey.URI, state.xkey.IV, state.xkey.Keyformat, state.xkey.Keyformatversions}
+		// First EXT-X-KEY may appeared in the header of the playlist and linked to first segment
+		// but for convenient playlist generation it also linked as default playlist key
+		if p.Key == nil {
+			p.Key = state.xkey
+		}
+		state.tagKey = false
+	}
+	// If EXT-X-MAP appeared before reference to segment (EXTINF) then it linked to this segment
+	if state.tagMap && p.Count() > 0 {
+		p.Segments[p.last()].Map = &Map{state.xmap.URI, state.xmap.Limit, state.xmap.Offset}
+		// First EXT-X-MAP may appeared in the header of the playlist and linked to first segment
+		// but for convenient playlist generation it also linked as default playlist map
+		if p.Map == nil {
+			p.Map = state.xmap
+		}
+		state.tagMap = false
+	}
 
-		// if segment custom tag appeared before EXTINF then it links to this segment
-		if state.tagCustom {
-			p.Segments[p.last()].Custom = state.custom
-			state.custom = make(map[string]CustomTag)
-			state.tagCustom = false
-		}
-	// start tag first
-	case line == "#EXTM3U":
+	// if segment custom tag appeared before EXTINF then it links to this segment
+	if state.tagCustom && p.Count() > 0 {
+		seg := p.Segments[p.last()]
+		seg.Custom, seg.customOrder = state.takeCustomTags()
+	}
+	return err
+}
+
+var mediaTagDecoders = map[string]mediaTagDecoder{
+	"#EXTM3U": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
 		state.m3u = true
-	case line == "#EXT-X-ENDLIST":
-		state.listType = MEDIA
+		return nil
+	},
+	"#EXTINF": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
+		if state.tagInf {
+			return nil
+		}
+		state.tagInf = true
+		state.infLine = state.lines
+		duration, title, found := strings.Cut(value, ",")
+		if !found && strict {
+			return fmt.Errorf("could not parse: %q", "#EXTINF:"+value)
+		}
+		state.duration = 0
+		if len(duration) > 0 {
+			if state.duration, err = strconv.ParseFloat(duration, 64); strict && err != nil {
+				return fmt.Errorf("duration parsing error: %s", err)
+			}
+		}
+		state.title = title
+		return err
+	},
+	"#EXT-X-ENDLIST": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
 		p.Closed = true
-	case strings.HasPrefix(line, "#EXT-X-VERSION:"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-VERSION:%d", &p.ver); strict && err != nil {
+		return nil
+	},
+	"#EXT-X-VERSION": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		ver, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
 			return err
 		}
-	case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-TARGETDURATION:%f", &p.TargetDuration); strict && err != nil {
+		p.ver = uint8(ver)
+		return nil
+	},
+	"#EXT-X-TARGETDURATION": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil {
 			return err
 		}
-	case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-MEDIA-SEQUENCE:%d", &p.SeqNo); strict && err != nil {
+		p.TargetDuration = duration
+		return nil
+	},
+	"#EXT-X-MEDIA-SEQUENCE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		seq, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
 			return err
 		}
-	case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE:"):
-		state.listType = MEDIA
-		var playlistType string
-		_, err = fmt.Sscanf(line, "#EXT-X-PLAYLIST-TYPE:%s", &playlistType)
+		p.SeqNo = seq
+		return nil
+	},
+	"#EXT-X-PLAYLIST-TYPE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		switch value {
+		case "EVENT":
+			p.MediaType = EVENT
+		case "VOD":
+			p.MediaType = VOD
+		case "":
+			return errors.New("playlist type value absent")
+		}
+		return nil
+	},
+	"#EXT-X-DISCONTINUITY-SEQUENCE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		seq, err := strconv.ParseUint(value, 10, 64)
 		if err != nil {
-			if strict {
-				return err
-			}
-		} else {
-			switch playlistType {
-			case "EVENT":
-				p.MediaType = EVENT
-			case "VOD":
-				p.MediaType = VOD
-			}
+			return err
 		}
-	case strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE:"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#EXT-X-DISCONTINUITY-SEQUENCE:%d", &p.DiscontinuitySeq); strict && err != nil {
+		p.DiscontinuitySeq = seq
+		return nil
+	},
+	"#EXT-X-START": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
 			return err
 		}
-	case strings.HasPrefix(line, "#EXT-X-START:"):
-		state.listType = MEDIA
-		for k, v := range decodeParamsLine(line[13:]) {
-			switch k {
+		for _, a := range attrs {
+			switch a.Name {
 			case "TIME-OFFSET":
-				st, err := strconv.ParseFloat(v, 64)
+				st, err := a.Float()
 				if err != nil {
-					return fmt.Errorf("invalid time-offset: %s: %v", v, err)
+					return fmt.Errorf("invalid time-offset: %s: %v", a.Value, err)
 				}
 				p.StartTime = st
 			case "PRECISE":
-				p.StartTimePrecise = v == "YES"
+				p.StartTimePrecise, _ = a.Bool()
 			}
 		}
-	case strings.HasPrefix(line, "#EXT-X-KEY:"):
-		state.listType = MEDIA
+		return nil
+	},
+	"#EXT-X-KEY": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
 		state.xkey = new(Key)
-		for k, v := range decodeParamsLine(line[11:]) {
-			switch k {
-			case "METHOD":
-				state.xkey.Method = v
-			case "URI":
-				state.xkey.URI = v
-			case "IV":
-				state.xkey.IV = v
-			case "KEYFORMAT":
-				state.xkey.Keyformat = v
-			case "KEYFORMATVERSIONS":
-				state.xkey.Keyformatversions = v
-			}
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
 		}
+		decodeKey(state.xkey, attrs)
+		state.xkey.URI = state.resolveURI(state.xkey.URI)
 		state.tagKey = true
-	case strings.HasPrefix(line, "#EXT-X-MAP:"):
-		state.listType = MEDIA
+		return nil
+	},
+	"#EXT-X-MAP": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
 		state.xmap = new(Map)
-		for k, v := range decodeParamsLine(line[11:]) {
-			switch k {
-			case "URI":
-				state.xmap.URI = v
-			case "BYTERANGE":
-				if _, err = fmt.Sscanf(v, "%d@%d", &state.xmap.Limit, &state.xmap.Offset); strict && err != nil {
-					return fmt.Errorf("byterange sub-range length value parsing error: %s", err)
-				}
-			}
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		err = decodeMap(state.xmap, attrs)
+		if strict && err != nil {
+			return err
 		}
+		state.xmap.URI = state.resolveURI(state.xmap.URI)
 		state.tagMap = true
-	case !state.tagProgramDateTime && strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+		return err
+	},
+	"#EXT-X-PROGRAM-DATE-TIME": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
+		if state.tagProgramDateTime {
+			return nil
+		}
 		state.tagProgramDateTime = true
-		state.listType = MEDIA
-		if state.programDateTime, err = TimeParse(line[25:]); strict && err != nil {
+		if state.programDateTime, err = state.timeParse(value); strict && err != nil {
 			return err
 		}
-	case !state.tagRange && strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+		return err
+	},
+	"#EXT-X-BYTERANGE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		var err error
+		if state.tagRange {
+			return nil
+		}
 		state.tagRange = true
-		state.listType = MEDIA
 		state.offset = 0
-		params := strings.SplitN(line[17:], "@", 2)
-		if state.limit, err = strconv.ParseInt(params[0], 10, 64); strict && err != nil {
+		length, offset, hasOffset := strings.Cut(value, "@")
+		if state.limit, err = strconv.ParseInt(length, 10, 64); strict && err != nil {
 			return fmt.Errorf("byterange sub-range length value parsing error: %s", err)
 		}
-		if len(params) > 1 {
-			if state.offset, err = strconv.ParseInt(params[1], 10, 64); strict && err != nil {
+		if hasOffset {
+			if state.offset, err = strconv.ParseInt(offset, 10, 64); strict && err != nil {
 				return fmt.Errorf("byterange sub-range offset value parsing error: %s", err)
 			}
 		}
-	case !state.tagSCTE35 && strings.HasPrefix(line, "#EXT-SCTE35:"):
+		return err
+	},
+	"#EXT-SCTE35": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		if state.tagSCTE35 {
+			return nil
+		}
 		state.tagSCTE35 = true
-		state.listType = MEDIA
 		state.scte = new(SCTE)
 		state.scte.Syntax = SCTE35_67_2014
-		for attribute, value := range decodeParamsLine(line[12:]) {
-			switch attribute {
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			switch a.Name {
 			case "CUE":
-				state.scte.Cue = value
+				state.scte.Cue = a.Value
 			case "ID":
-				state.scte.ID = value
+				state.scte.ID = a.Value
 			case "TIME":
-				state.scte.Time, _ = strconv.ParseFloat(value, 64)
+				state.scte.Time, _ = a.Float()
 			}
 		}
-	case !state.tagSCTE35 && strings.HasPrefix(line, "#EXT-OATCLS-SCTE35:"):
+		return nil
+	},
+	"#EXT-OATCLS-SCTE35": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
 		// EXT-OATCLS-SCTE35 contains the SCTE35 tag, EXT-X-CUE-OUT contains duration
+		if state.tagSCTE35 {
+			return nil
+		}
 		state.tagSCTE35 = true
 		state.scte = new(SCTE)
 		state.scte.Syntax = SCTE35_OATCLS
-		state.scte.Cue = line[19:]
-	case state.tagSCTE35 && state.scte.Syntax == SCTE35_OATCLS && strings.HasPrefix(line, "#EXT-X-CUE-OUT:"):
-		// EXT-OATCLS-SCTE35 contains the SCTE35 tag, EXT-X-CUE-OUT contains duration
-		state.scte.Time, _ = strconv.ParseFloat(line[15:], 64)
-		state.scte.CueType = SCTE35Cue_Start
-	case !state.tagSCTE35 && strings.HasPrefix(line, "#EXT-X-CUE-OUT-CONT:"):
+		state.scte.Cue = value
+		return nil
+	},
+	"#EXT-X-CUE-OUT": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		switch {
+		case state.tagSCTE35 && state.scte.Syntax == SCTE35_OATCLS && value != "":
+			// EXT-OATCLS-SCTE35 contains the SCTE35 tag, EXT-X-CUE-OUT contains duration
+			state.scte.Time, _ = strconv.ParseFloat(value, 64)
+			state.scte.CueType = SCTE35Cue_Start
+		case !state.tagSCTE35:
+			state.tagSCTE35 = true
+			state.scte = new(SCTE)
+			state.scte.Syntax = SCTE35_OATCLS
+			state.scte.CueType = SCTE35Cue_Start
+			if value != "" {
+				state.scte.Time, _ = strconv.ParseFloat(value, 64)
+			}
+		}
+		return nil
+	},
+	"#EXT-X-CUE-OUT-CONT": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		if state.tagSCTE35 {
+			return nil
+		}
 		state.tagSCTE35 = true
 		state.scte = new(SCTE)
 		state.scte.Syntax = SCTE35_OATCLS
 		state.scte.CueType = SCTE35Cue_Mid
-		for attribute, value := range decodeParamsLine(line[20:]) {
-			switch attribute {
+		attrs, err := state.decodeAttributes(value)
+		if err != nil {
+			return err
+		}
+		for _, a := range attrs {
+			switch a.Name {
 			case "SCTE35":
-				state.scte.Cue = value
+				state.scte.Cue = a.Value
 			case "Duration":
-				state.scte.Time, _ = strconv.ParseFloat(value, 64)
+				state.scte.Time, _ = a.Float()
 			case "ElapsedTime":
-				state.scte.Elapsed, _ = strconv.ParseFloat(value, 64)
+				state.scte.Elapsed, _ = a.Float()
 			}
 		}
-	case !state.tagSCTE35 && strings.HasPrefix(line, "#EXT-X-CUE-OUT"):
-		state.tagSCTE35 = true
-		state.scte = new(SCTE)
-		state.scte.Syntax = SCTE35_OATCLS
-		state.scte.CueType = SCTE35Cue_Start
-		lenLine := len(line)
-		if lenLine > 14 {
-			state.scte.Time, _ = strconv.ParseFloat(line[15:], 64)
+		return nil
+	},
+	"#EXT-X-CUE-IN": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		if state.tagSCTE35 {
+			return nil
 		}
-	case !state.tagSCTE35 && line == "#EXT-X-CUE-IN":
 		state.tagSCTE35 = true
 		state.scte = new(SCTE)
 		state.scte.Syntax = SCTE35_OATCLS
 		state.scte.CueType = SCTE35Cue_End
-	case state.tagDiscontinuity == nil && strings.HasPrefix(line, "#EXT-X-DISCONTINUITY"):
-		state.listType = MEDIA
-		value := 0.0
-		if _, scanErr := fmt.Sscanf(line, "#EXT-X-DISCONTINUITY:%f", &value); strict && scanErr != nil && scanErr != io.ErrUnexpectedEOF {
-			return scanErr
-		}
-		state.tagDiscontinuity = &value
-	case strings.HasPrefix(line, "#EXT-X-I-FRAMES-ONLY"):
-		state.listType = MEDIA
-		p.Iframe = true
-	case strings.HasPrefix(line, "#WV-AUDIO-CHANNELS"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-CHANNELS %d", &wv.AudioChannels); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-AUDIO-FORMAT"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-FORMAT %d", &wv.AudioFormat); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-AUDIO-PROFILE-IDC"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-PROFILE-IDC %d", &wv.AudioProfileIDC); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-AUDIO-SAMPLE-SIZE"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLE-SIZE %d", &wv.AudioSampleSize); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-AUDIO-SAMPLING-FREQUENCY"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-AUDIO-SAMPLING-FREQUENCY %d", &wv.AudioSamplingFrequency); strict && err != nil {
-			return err
+		return nil
+	},
+	"#EXT-X-DISCONTINUITY": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		if state.tagDiscontinuity != nil {
+			return nil
 		}
-		if err == nil {
-			state.tagWV = true
+		var discontinuity float64
+		if value != "" {
+			var err error
+			if discontinuity, err = strconv.ParseFloat(value, 64); strict && err != nil {
+				return err
+			}
 		}
-	case strings.HasPrefix(line, "#WV-CYPHER-VERSION"):
-		state.listType = MEDIA
-		wv.CypherVersion = line[19:]
+		state.tagDiscontinuity = &discontinuity
+		return nil
+	},
+	"#EXT-X-I-FRAMES-ONLY": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		p.Iframe = true
+		return nil
+	},
+	"#WV-AUDIO-CHANNELS": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.AudioChannels, value)
+	},
+	"#WV-AUDIO-FORMAT": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.AudioFormat, value)
+	},
+	"#WV-AUDIO-PROFILE-IDC": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.AudioProfileIDC, value)
+	},
+	"#WV-AUDIO-SAMPLE-SIZE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.AudioSampleSize, value)
+	},
+	"#WV-AUDIO-SAMPLING-FREQUENCY": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.AudioSamplingFrequency, value)
+	},
+	"#WV-CYPHER-VERSION": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		state.wv.CypherVersion = value
 		state.tagWV = true
-	case strings.HasPrefix(line, "#WV-ECM"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-ECM %s", &wv.ECM); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-VIDEO-FORMAT"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FORMAT %d", &wv.VideoFormat); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-VIDEO-FRAME-RATE"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-FRAME-RATE %d", &wv.VideoFrameRate); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-VIDEO-LEVEL-IDC"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-LEVEL-IDC %d", &wv.VideoLevelIDC); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-VIDEO-PROFILE-IDC"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-PROFILE-IDC %d", &wv.VideoProfileIDC); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#WV-VIDEO-RESOLUTION"):
-		state.listType = MEDIA
-		wv.VideoResolution = line[21:]
+		return nil
+	},
+	"#WV-ECM": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVWord(state, &state.wv.ECM, value)
+	},
+	"#WV-VIDEO-FORMAT": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.VideoFormat, value)
+	},
+	"#WV-VIDEO-FRAME-RATE": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.VideoFrameRate, value)
+	},
+	"#WV-VIDEO-LEVEL-IDC": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.VideoLevelIDC, value)
+	},
+	"#WV-VIDEO-PROFILE-IDC": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVUint(state, &state.wv.VideoProfileIDC, value)
+	},
+	"#WV-VIDEO-RESOLUTION": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		state.wv.VideoResolution = value
 		state.tagWV = true
-	case strings.HasPrefix(line, "#WV-VIDEO-SAR"):
-		state.listType = MEDIA
-		if _, err = fmt.Sscanf(line, "#WV-VIDEO-SAR %s", &wv.VideoSAR); strict && err != nil {
-			return err
-		}
-		if err == nil {
-			state.tagWV = true
-		}
-	case strings.HasPrefix(line, "#"):
-		// comments are ignored
+		return nil
+	},
+	"#WV-VIDEO-SAR": func(p *MediaPlaylist, state *decodingState, value string, strict bool) error {
+		return decodeWVWord(state, &state.wv.VideoSAR, value)
+	},
+}
+
+// decodeWVUint parses numeric value of Widevine tag.
+func decodeWVUint(state *decodingState, dst *uint, value string) error {
+	v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 0)
+	if err != nil {
+		return err
 	}
-	return err
+	*dst = uint(v)
+	state.tagWV = true
+	return nil
+}
+
+// decodeWVWord takes the first word of Widevine tag value.
+func decodeWVWord(state *decodingState, dst *string, value string) error {
+	value, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+	if value == "" {
+		return errors.New("widevine tag value absent")
+	}
+	*dst = value
+	state.tagWV = true
+	return nil
 }
 
 // StrictTimeParse implements RFC3339 with Nanoseconds accuracy.
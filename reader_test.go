@@ -16,6 +16,8 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -445,6 +447,9 @@ func TestDecodeMediaPlaylistWithWidevine(t *testing.T) {
 	if p.TargetDuration != 9 {
 		t.Errorf("TargetDuration of parsed playlist = %f (must = 9.0)", p.TargetDuration)
 	}
+	if out := p.String(); !strings.Contains(out, "#WV-VIDEO-LEVEL-IDC 12\n") {
+		t.Errorf("WV-VIDEO-LEVEL-IDC is not encoded as in the source:\n%s", out)
+	}
 	// TODO check other values…
 	//fmt.Printf("%+v\n", p.Key)
 	//fmt.Println(p.Encode().String())
@@ -471,6 +476,61 @@ func TestDecodeMasterPlaylistWithAutodetection(t *testing.T) {
 	CheckType(t, mp)
 }
 
+// Renditions must be attached to variants only once when the type of
+// the playlist is detected automatically.
+func TestDecodeMasterPlaylistWithAlternativesAutodetection(t *testing.T) {
+	f, err := os.Open("sample-playlists/master-with-alternatives-and-i-frame.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, listType, err := DecodeFrom(bufio.NewReader(f), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MASTER {
+		t.Fatal("Sample not recognized as master playlist.")
+	}
+	mp := p.(*MasterPlaylist)
+	if len(mp.Variants) != 4 {
+		t.Fatal("not all variants in master playlist parsed")
+	}
+	// the renditions are attached by the groups, the I-frame variant
+	// doesn't take them from the variants around it
+	for i, expected := range []int{3, 2, 1, 0} {
+		if n := len(mp.Variants[i].Alternatives); n != expected {
+			t.Errorf("variant %d has %d alternatives but should be %d", i, n, expected)
+		}
+	}
+	if alt := mp.Variants[1].Alternatives[0]; alt != mp.Variants[0].Alternatives[1] || alt.GroupId != "low" {
+		t.Errorf("I-frame variant has rendition %+v", alt)
+	}
+	out := mp.String()
+	if strings.LastIndex(out, "#EXT-X-MEDIA:") > strings.Index(out, "#EXT-X-STREAM-INF:") {
+		t.Errorf("Renditions are encoded after the variant:\n%s", out)
+	}
+}
+
+func TestDetectListType(t *testing.T) {
+	tests := []struct {
+		src      string
+		listType ListType
+		m3u      bool
+	}{
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n", MASTER, true},
+		{"#EXTM3U\n#EXT-X-VERSION:4\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"a\"\n", MASTER, true},
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-MEDIA-SEQUENCE:1\n", MEDIA, true},
+		{"#EXT-X-TARGETDURATION:10\n#EXTM3U\n", MEDIA, false},
+		{"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-INDEPENDENT-SEGMENTS\n", 0, true},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		listType, m3u := detectListType(test.src)
+		if listType != test.listType || m3u != test.m3u {
+			t.Errorf("detectListType(%q) = %v, %v; want %v, %v", test.src, listType, m3u, test.listType, test.m3u)
+		}
+	}
+}
+
 func TestDecodeMediaPlaylistWithAutodetection(t *testing.T) {
 	f, err := os.Open("sample-playlists/wowza-vod-chunklist.m3u8")
 	if err != nil {
@@ -1053,11 +1113,455 @@ func TestDecodeMediaPlaylistWithCueOutCueIn(t *testing.T) {
 	}
 }
 
+func TestDecodeCustomTagsKeepSourceOrder(t *testing.T) {
+	src := "#EXTM3U\n#X-PL-B\n#X-PL-A\n#EXT-X-TARGETDURATION:10\n#X-SEG-B\n#X-SEG-A\n#EXTINF:10,\na.ts\n"
+	var decoders []CustomDecoder
+	for _, name := range []string{"#X-PL-A", "#X-PL-B"} {
+		decoders = append(decoders, &MockCustomTag{name: name, encodedString: name})
+	}
+	for _, name := range []string{"#X-SEG-A", "#X-SEG-B"} {
+		decoders = append(decoders, &MockCustomTag{name: name, encodedString: name, segment: true})
+	}
+	p, listType, err := DecodeWith(*bytes.NewBufferString(src), true, decoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MEDIA {
+		t.Fatalf("got list type %v, want MEDIA", listType)
+	}
+	out := p.String()
+	for _, expected := range []string{"#X-PL-B\n#X-PL-A\n", "#X-SEG-B\n#X-SEG-A\n#EXTINF"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Custom tags lost the source order, %q expected in:\n%s", expected, out)
+		}
+	}
+}
+
+func TestDecodeRepeatedCustomTags(t *testing.T) {
+	src := "#EXTM3U\n#X-ASSET:1\n#X-ASSET:2\n#EXT-X-TARGETDURATION:10\n#X-SEG:A\n#X-SEG:B\n#EXTINF:10,\na.ts\n#X-SEG:C\n#EXTINF:10,\nb.ts\n"
+	decoders := []CustomDecoder{
+		&lineTagDecoder{name: "#X-ASSET:"},
+		&lineTagDecoder{name: "#X-SEG:", segment: true},
+	}
+	p, _, err := DecodeWith(*bytes.NewBufferString(src), true, decoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+	if n := len(CustomTags(pp.Custom, "#X-ASSET:")); n != 2 {
+		t.Errorf("Got %d playlist tags, expected 2", n)
+	}
+	if n := len(CustomTags(pp.Segments[0].Custom, "#X-SEG:")); n != 2 {
+		t.Errorf("Got %d tags on the first segment, expected 2", n)
+	}
+	if n := len(CustomTags(pp.Segments[1].Custom, "#X-SEG:")); n != 1 {
+		t.Errorf("Got %d tags on the second segment, expected 1", n)
+	}
+	out := p.String()
+	for _, expected := range []string{"#X-ASSET:1\n#X-ASSET:2\n", "#X-SEG:A\n#X-SEG:B\n#EXTINF", "#X-SEG:C\n#EXTINF"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Playlist does not contain %q:\n%s", expected, out)
+		}
+	}
+}
+
+func TestDecodeInterleavedCustomTags(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-VERSION:3\n#X-A:1\n#X-B:1\n#X-A:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-TARGETDURATION:10\n#X-SEG:A\n#X-OTHER:1\n#X-SEG:B\n#EXTINF:10.000,\na.ts\n"
+	decoders := []CustomDecoder{
+		&lineTagDecoder{name: "#X-A:"},
+		&lineTagDecoder{name: "#X-B:"},
+		&lineTagDecoder{name: "#X-SEG:", segment: true},
+		&lineTagDecoder{name: "#X-OTHER:", segment: true},
+	}
+	p, _, err := DecodeWith(*bytes.NewBufferString(src), true, decoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := p.String(); out != src {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", out, src)
+	}
+
+	// Set replaces the tags at the position of the first one
+	pp := p.(*MediaPlaylist)
+	pp.SetCustomTag(&MockCustomTag{name: "#X-A:", encodedString: "#X-A:3"})
+	pp.ResetCache()
+	if out := pp.String(); !strings.Contains(out, "#X-A:3\n#X-B:1\n#EXT-X-MEDIA-SEQUENCE") {
+		t.Errorf("Got playlist\n%s", out)
+	}
+}
+
+func TestDecodeSkippedCustomTags(t *testing.T) {
+	decoders := []CustomDecoder{
+		&nilTagDecoder{lineTagDecoder{name: "#X-SKIP:"}},
+		&nilTagDecoder{lineTagDecoder{name: "#X-SEG-SKIP:", segment: true}},
+	}
+	src := "#EXTM3U\n#X-SKIP:1\n#EXT-X-TARGETDURATION:10\n#X-SEG-SKIP:1\n#EXTINF:10,\na.ts\n"
+	p, _, err := DecodeWith(*bytes.NewBufferString(src), true, decoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pp := p.(*MediaPlaylist)
+	if len(pp.Custom) != 0 || len(pp.Segments[0].Custom) != 0 {
+		t.Errorf("Got custom tags %v and %v for skipped lines", pp.Custom, pp.Segments[0].Custom)
+	}
+
+	src = "#EXTM3U\n#X-SKIP:1\n#EXT-X-STREAM-INF:BANDWIDTH=1\nlow.m3u8\n"
+	if p, _, err = DecodeWith(*bytes.NewBufferString(src), true, decoders); err != nil {
+		t.Fatal(err)
+	}
+	if custom := p.(*MasterPlaylist).Custom; len(custom) != 0 {
+		t.Errorf("Got custom tags %v for skipped lines", custom)
+	}
+}
+
+func TestDecodeMediaPlaylistWithContextDecoder(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MEDIA-SEQUENCE:5\n#X-SEG:A\n#EXTINF:10,\na.ts\n#X-SEG:B\n#EXTINF:10,\nb.ts\n"
+	dec := &contextTagDecoder{lineTagDecoder: lineTagDecoder{name: "#X-SEG:", segment: true}}
+	p, err := NewMediaPlaylist(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithCustomDecoders([]CustomDecoder{dec})
+	if err = p.Decode(*bytes.NewBufferString(src), true); err != nil {
+		t.Fatal(err)
+	}
+	if len(dec.contexts) != 2 {
+		t.Fatalf("Decoder called %d times, expected 2", len(dec.contexts))
+	}
+	first, second := dec.contexts[0], dec.contexts[1]
+	if first.Line != 4 || second.Line != 7 {
+		t.Errorf("Got lines %d and %d, expected 4 and 7", first.Line, second.Line)
+	}
+	if !first.Strict || first.Media != p || first.Master != nil {
+		t.Errorf("Wrong playlist in the context: %+v", first)
+	}
+	if first.PrevSegment != nil || first.SegmentSeqId != 5 {
+		t.Errorf("Wrong segment in the first context: %+v", first)
+	}
+	if second.PrevSegment == nil || second.PrevSegment.URI != "a.ts" || second.SegmentSeqId != 6 {
+		t.Errorf("Wrong segment in the second context: %+v", second)
+	}
+	if tags := CustomTags(second.PrevSegment.Custom, "#X-SEG:"); len(tags) != 1 || tags[0].String() != "#X-SEG:A" {
+		t.Errorf("Previous segment tags are not available: %v", tags)
+	}
+}
+
+func TestDecodeWithContextDecoderMode(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:8,\na.ts\n"
+	for _, mode := range []DecoderMode{DecodeAlongside, DecodeReplace} {
+		dec := &contextTagDecoder{lineTagDecoder: lineTagDecoder{name: "#EXT-X-TARGETDURATION:"}, mode: mode}
+		p, _, err := DecodeWith(*bytes.NewBufferString(src), true, []CustomDecoder{dec})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pp := p.(*MediaPlaylist)
+		if len(CustomTags(pp.Custom, "#EXT-X-TARGETDURATION:")) != 1 {
+			t.Errorf("Mode %d: custom tag not decoded", mode)
+		}
+		builtin := pp.TargetDuration == 10
+		if builtin != (mode == DecodeAlongside) {
+			t.Errorf("Mode %d: built-in handling applied = %v", mode, builtin)
+		}
+	}
+}
+
+func TestDecodeMasterPlaylistWithVariantTags(t *testing.T) {
+	src := `#EXTM3U
+#X-HEADER:1
+#X-DRM:audio
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,URI="en.m3u8"
+#X-DRM:low
+#X-DRM:low2
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+#EXT-X-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=2560000,AUDIO="aac"
+hi.m3u8
+#X-DRM:iframe
+#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=1,BANDWIDTH=86000,URI="iframe.m3u8"
+`
+	decoders := []CustomDecoder{
+		&lineTagDecoder{name: "#X-HEADER:"},
+		&variantTagDecoder{lineTagDecoder{name: "#X-DRM:"}},
+	}
+	p, listType, err := DecodeWith(*bytes.NewBufferString(src), true, decoders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listType != MASTER {
+		t.Fatalf("got list type %v, want MASTER", listType)
+	}
+	pp := p.(*MasterPlaylist)
+	if len(pp.Custom) != 1 || pp.Custom["#X-HEADER:"] == nil {
+		t.Errorf("Wrong master playlist tags: %v", pp.Custom)
+	}
+	expected := [][]string{{"#X-DRM:low", "#X-DRM:low2"}, nil, {"#X-DRM:iframe"}}
+	for i, v := range pp.Variants {
+		var got []string
+		for _, tag := range CustomTags(v.Custom, "#X-DRM:") {
+			got = append(got, tag.String())
+		}
+		if !reflect.DeepEqual(got, expected[i]) {
+			t.Errorf("Variant %d: got tags %v, expected %v", i, got, expected[i])
+		}
+	}
+	var alt *Alternative
+	for _, v := range pp.Variants {
+		if len(v.Alternatives) > 0 {
+			alt = v.Alternatives[0]
+			break
+		}
+	}
+	if alt == nil {
+		t.Fatal("Rendition is not decoded")
+	}
+	if tags := CustomTags(alt.Custom, "#X-DRM:"); len(tags) != 1 || tags[0].String() != "#X-DRM:audio" {
+		t.Errorf("Wrong rendition tags: %v", alt.Custom)
+	}
+	if out := p.String(); !strings.Contains(out, "#X-DRM:audio\n#EXT-X-MEDIA:") ||
+		!strings.Contains(out, "#X-DRM:low\n#X-DRM:low2\n#EXT-X-STREAM-INF:") ||
+		!strings.Contains(out, "#X-DRM:iframe\n#EXT-X-I-FRAME-STREAM-INF:") {
+		t.Errorf("Variant tags are not encoded in place:\n%s", out)
+	}
+}
+
+func TestDecodeWithLimits(t *testing.T) {
+	const media = "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\na.ts\n#EXTINF:10,\nb.ts\n#EXTINF:10,\nc.ts\n"
+	const master = "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1,CODECS=\"avc1\",RESOLUTION=1x1\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=2\nhi.m3u8\n"
+	tests := []struct {
+		name   string
+		src    string
+		strict bool
+		limits DecodeLimits
+		err    error
+	}{
+		{"bytes", media, true, DecodeLimits{MaxBytes: 20}, ErrTooManyBytes},
+		{"lines", media, false, DecodeLimits{MaxLines: 4}, ErrTooManyLines},
+		{"line length", media, false, DecodeLimits{MaxLineLength: 16}, ErrLineTooLong},
+		{"segments", media, false, DecodeLimits{MaxSegments: 2}, ErrTooManySegments},
+		{"variants", master, false, DecodeLimits{MaxVariants: 1}, ErrTooManyVariants},
+		{"attributes", master, false, DecodeLimits{MaxAttributes: 2}, ErrTooManyAttributes},
+		{"within limits", media, true, DecodeLimits{MaxBytes: 100, MaxLines: 10, MaxLineLength: 30, MaxSegments: 3, MaxAttributes: 3}, nil},
+	}
+	for _, test := range tests {
+		_, _, err := DecodeWithLimits(bytes.NewBufferString(test.src), test.strict, nil, test.limits)
+		if err != test.err {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+		if test.err != nil && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: error %v doesn't wrap ErrLimitExceeded", test.name, err)
+		}
+	}
+}
+
+func TestDecodeWithLinesLimit(t *testing.T) {
+	const lines = "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\na.ts" // 4 lines
+	for _, src := range []string{lines, lines + "\n"} {
+		for _, max := range []int{4, 3} {
+			var expected error
+			if max < 4 {
+				expected = ErrTooManyLines
+			}
+			if _, _, err := DecodeWithLimits(bytes.NewBufferString(src), true, nil, DecodeLimits{MaxLines: max}); err != expected {
+				t.Errorf("%q with %d lines allowed: got error %v, expected %v", src, max, err, expected)
+			}
+			p, err := NewMediaPlaylist(0, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.WithLimits(DecodeLimits{MaxLines: max})
+			if err = p.DecodeFrom(strings.NewReader(src), true); err != expected {
+				t.Errorf("%q with %d lines allowed: got error %v, expected %v", src, max, err, expected)
+			}
+		}
+	}
+}
+
+func TestDecodeMediaPlaylistWithSegmentsLimit(t *testing.T) {
+	f, err := os.Open("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithLimits(DecodeLimits{MaxSegments: 100})
+	if err = p.DecodeFrom(f, false); err != ErrTooManySegments {
+		t.Fatalf("got error %v, want %v", err, ErrTooManySegments)
+	}
+	if p.Count() != 100 || len(p.Segments) > 100 {
+		t.Errorf("playlist grew beyond the limit: %d segments, capacity %d", p.Count(), len(p.Segments))
+	}
+}
+
+func TestDecodeTruncatedTags(t *testing.T) {
+	tags := []string{
+		"#EXT-X-VERSION", "#EXT-X-MEDIA", "#EXT-X-STREAM-INF", "#EXT-X-I-FRAME-STREAM-INF",
+		"#EXTINF", "#EXT-X-TARGETDURATION", "#EXT-X-MEDIA-SEQUENCE", "#EXT-X-PLAYLIST-TYPE",
+		"#EXT-X-DISCONTINUITY-SEQUENCE", "#EXT-X-START", "#EXT-X-KEY", "#EXT-X-MAP",
+		"#EXT-X-PROGRAM-DATE-TIME", "#EXT-X-BYTERANGE", "#EXT-SCTE35", "#EXT-OATCLS-SCTE35",
+		"#EXT-X-CUE-OUT", "#EXT-X-CUE-OUT-CONT", "#EXT-X-DISCONTINUITY", "#WV-ECM", "#WV-VIDEO-SAR",
+		"#WV-AUDIO-CHANNELS",
+	}
+	for _, tag := range tags {
+		for _, line := range []string{tag, tag + ":", tag + " "} {
+			src := "#EXTM3U\n" + line + "\n" + line + "\nx\n"
+			for _, strict := range []bool{true, false} {
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Errorf("decoding %q panics: %v", line, r)
+						}
+					}()
+					NewMasterPlaylist().Decode(*bytes.NewBufferString(src), strict)
+					p, _ := NewMediaPlaylist(1, 1)
+					p.Decode(*bytes.NewBufferString(src), strict)
+				}()
+			}
+		}
+	}
+}
+
+func TestDecodeWithOptionsTimeParse(t *testing.T) {
+	// not RFC3339 so only the full parser accepts it
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-PROGRAM-DATE-TIME:2018-12-31T09:47:22+03\n#EXTINF:10,\na.ts\n"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(strict bool) {
+			defer wg.Done()
+			opts := DecoderOptions{Strict: true, TimeParse: FullTimeParse}
+			if strict {
+				opts.TimeParse = StrictTimeParse
+			}
+			_, _, err := DecodeWithOptions(strings.NewReader(src), opts)
+			if strict && err == nil {
+				t.Error("Strict time parser accepted not RFC3339 time")
+			}
+			if !strict && err != nil {
+				t.Errorf("Full time parser failed: %v", err)
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+}
+
+func TestDecodeWithOptionsBaseURI(t *testing.T) {
+	opts := DecoderOptions{Strict: true, BaseURI: "https://example.com/live/master.m3u8"}
+
+	master := NewMasterPlaylist()
+	src := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="audio/en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO="aac"
+https://cdn.example.com/high/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,URI="../iframes.m3u8"
+`
+	if err := master.DecodeWithOptions(strings.NewReader(src), opts); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"https://example.com/live/low/index.m3u8",
+		"https://cdn.example.com/high/index.m3u8",
+		"https://example.com/iframes.m3u8",
+	}
+	for i, v := range master.Variants {
+		if v.URI != expected[i] {
+			t.Errorf("Variant %d: got URI %s, expected %s", i, v.URI, expected[i])
+		}
+	}
+	for _, v := range master.Variants {
+		for _, alt := range v.Alternatives {
+			if alt.URI != "https://example.com/live/audio/en.m3u8" {
+				t.Errorf("Got rendition URI %s", alt.URI)
+			}
+		}
+	}
+
+	media, err := NewMediaPlaylist(4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src = `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128,URI="/keys/1"
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10,
+seg0.ts
+`
+	if err = media.DecodeWithOptions(strings.NewReader(src), opts); err != nil {
+		t.Fatal(err)
+	}
+	seg := media.Segments[0]
+	if seg.URI != "https://example.com/live/seg0.ts" {
+		t.Errorf("Got segment URI %s", seg.URI)
+	}
+	if media.Key.URI != "https://example.com/keys/1" {
+		t.Errorf("Got key URI %s", media.Key.URI)
+	}
+	if media.Map.URI != "https://example.com/live/init.mp4" {
+		t.Errorf("Got map URI %s", media.Map.URI)
+	}
+
+	if _, _, err = DecodeWithOptions(strings.NewReader(src), DecoderOptions{BaseURI: "%zz"}); err == nil {
+		t.Error("Invalid base URI accepted")
+	}
+}
+
+func TestDecodeWithOptionsCustomDecoders(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#X-TAG:1\n#EXTINF:10,\na.ts\n"
+	opts := DecoderOptions{
+		Strict:         true,
+		CustomDecoders: []CustomDecoder{&lineTagDecoder{name: "#X-TAG:", segment: true}},
+		Limits:         DecodeLimits{MaxSegments: 1},
+	}
+	p, listType, err := DecodeWithOptions(strings.NewReader(src), opts)
+	if err != nil || listType != MEDIA {
+		t.Fatalf("Got %v, %v", listType, err)
+	}
+	if _, ok := p.(*MediaPlaylist).Segments[0].Custom["#X-TAG:"]; !ok {
+		t.Error("Custom tag not decoded")
+	}
+	src += "#EXTINF:10,\nb.ts\n"
+	if _, _, err = DecodeWithOptions(strings.NewReader(src), opts); !errors.Is(err, ErrTooManySegments) {
+		t.Errorf("Got error %v, expected ErrTooManySegments", err)
+	}
+}
+
+func TestDecodeWithOptionsLines(t *testing.T) {
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\n#EXTINF:10,\na.ts\n#X-UNKNOWN\n\n#EXTINF:10,\nb.ts\n"
+	lines := make(LineIndex)
+	p, _, err := DecodeWithOptions(strings.NewReader(src), DecoderOptions{Lines: lines})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segs := p.(*MediaPlaylist).GetAllSegments()
+	if lines[segs[0]] != 3 || lines[segs[1]] != 8 || lines["#EXTINF"] != 3 || lines["#EXT-X-TARGETDURATION"] != 2 {
+		t.Errorf("Got lines %v", lines)
+	}
+
+	src = "#EXTM3U\n#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"en\"\n#EXT-X-STREAM-INF:BANDWIDTH=1,AUDIO=\"aac\"\nlow.m3u8\n#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=1,URI=\"i.m3u8\"\n"
+	lines = make(LineIndex)
+	p, _, err = DecodeWithOptions(strings.NewReader(src), DecoderOptions{Lines: lines})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants := p.(*MasterPlaylist).Variants
+	alt := p.(*MasterPlaylist).Variants[0].Alternatives[0]
+	if lines[variants[0]] != 3 || lines[variants[1]] != 5 || lines[alt] != 2 {
+		t.Errorf("Got lines %v", lines)
+	}
+}
+
 /****************
  *  Benchmarks  *
  ****************/
 
 func BenchmarkDecodeMasterPlaylist(b *testing.B) {
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		f, err := os.Open("sample-playlists/master.m3u8")
 		if err != nil {
@@ -1071,6 +1575,7 @@ func BenchmarkDecodeMasterPlaylist(b *testing.B) {
 }
 
 func BenchmarkDecodeMediaPlaylist(b *testing.B) {
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		f, err := os.Open("sample-playlists/media-playlist-large.m3u8")
 		if err != nil {
@@ -1083,5 +1588,20 @@ func BenchmarkDecodeMediaPlaylist(b *testing.B) {
 		if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
 			b.Fatal(err)
 		}
+		f.Close()
+	}
+}
+
+func BenchmarkDecodeMediaPlaylistWithAutodetection(b *testing.B) {
+	data, err := os.ReadFile("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := DecodeFrom(bytes.NewReader(data), true); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,173 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines the registry of custom tags.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Registry keeps custom tag decoders registered once for use by many
+// decoders. It is safe for concurrent use, decoders take a snapshot
+// of the registered tags when decoding starts.
+type Registry struct {
+	mu       sync.RWMutex
+	names    []string // registration order
+	decoders map[string]CustomDecoder
+}
+
+// TagOptions defines where the registered tag belongs to and how it
+// is combined with the built-in handling of the tag with same name.
+type TagOptions struct {
+	Segment bool        // tag of the next media segment instead of the media playlist
+	Variant bool        // tag of the next variant or rendition instead of the master playlist
+	Mode    DecoderMode // DecodeReplace overrides the built-in handling of the tag
+}
+
+// NewRegistry creates an empty registry of custom tags.
+func NewRegistry() *Registry {
+	return &Registry{decoders: make(map[string]CustomDecoder)}
+}
+
+// Register adds the decoder to the registry. The decoder registered
+// earlier for the same tag name is replaced.
+func (r *Registry) Register(decoder CustomDecoder) {
+	name, _ := splitTag(decoder.TagName())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.decoders[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.decoders[name] = decoder
+}
+
+// Unregister removes the decoder of the tag from the registry.
+func (r *Registry) Unregister(tagName string) {
+	name, _ := splitTag(tagName)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.decoders[name]; !ok {
+		return
+	}
+	delete(r.decoders, name)
+	for i, v := range r.names {
+		if v == name {
+			r.names = append(r.names[:i], r.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Lookup returns the decoder registered for the tag.
+func (r *Registry) Lookup(tagName string) (CustomDecoder, bool) {
+	name, _ := splitTag(tagName)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	decoder, ok := r.decoders[name]
+	return decoder, ok
+}
+
+// Decoders returns the registered decoders in the order of
+// registration.
+func (r *Registry) Decoders() []CustomDecoder {
+	if r == nil {
+		return nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	decoders := make([]CustomDecoder, 0, len(r.names))
+	for _, name := range r.names {
+		decoders = append(decoders, r.decoders[name])
+	}
+	return decoders
+}
+
+// RegisterTag registers the tag with the decode function which
+// returns the tag as its concrete type. The tagName is the full
+// identifier as for CustomDecoder.TagName.
+func RegisterTag[T CustomTag](r *Registry, tagName string, decode func(line string) (T, error), opts TagOptions) {
+	r.Register(&registeredTag[T]{name: tagName, decode: decode, opts: opts})
+}
+
+// registeredTag adapts the decode function to ContextDecoder.
+type registeredTag[T CustomTag] struct {
+	name   string
+	decode func(line string) (T, error)
+	opts   TagOptions
+}
+
+func (t *registeredTag[T]) TagName() string {
+	return t.name
+}
+
+// Decode returns nil for the nil tag of the decode function, so the
+// line is skipped as for other custom decoders rather than stored as
+// the interface holding nil.
+func (t *registeredTag[T]) Decode(line string) (CustomTag, error) {
+	tag, err := t.decode(line)
+	if err != nil || isNil(tag) {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// isNil reports whether the tag is nil or the interface holds nil.
+func isNil(tag CustomTag) bool {
+	if tag == nil {
+		return true
+	}
+	switch v := reflect.ValueOf(tag); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Interface, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+func (t *registeredTag[T]) DecodeWithContext(_ *DecodingContext, line string) (CustomTag, error) {
+	return t.Decode(line)
+}
+
+func (t *registeredTag[T]) Mode() DecoderMode {
+	return t.opts.Mode
+}
+
+func (t *registeredTag[T]) SegmentTag() bool {
+	return t.opts.Segment
+}
+
+func (t *registeredTag[T]) VariantTag() bool {
+	return t.opts.Variant
+}
+
+// TagOf returns the first instance of the named custom tag as its
+// concrete type. It reports false if there is no tag of the type T.
+func TagOf[T CustomTag](custom map[string]CustomTag, tagName string) (T, bool) {
+	for _, tag := range CustomTags(custom, tagName) {
+		if v, ok := tag.(T); ok {
+			return v, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// TagsOf returns all the instances of the named custom tag which have
+// the concrete type T.
+func TagsOf[T CustomTag](custom map[string]CustomTag, tagName string) []T {
+	var tags []T
+	for _, tag := range CustomTags(custom, tagName) {
+		if v, ok := tag.(T); ok {
+			tags = append(tags, v)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,173 @@
+/*
+Custom tag registry tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// assetTag is a typed custom tag used by the registry tests.
+type assetTag struct {
+	ID int
+}
+
+func (t *assetTag) TagName() string {
+	return "#X-ASSET:"
+}
+
+func (t *assetTag) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.String())
+}
+
+func (t *assetTag) String() string {
+	return "#X-ASSET:ID=" + strconv.Itoa(t.ID)
+}
+
+func decodeAssetTag(line string) (*assetTag, error) {
+	attrs, err := ParseAttributeList(strings.TrimPrefix(line, "#X-ASSET:"))
+	if err != nil {
+		return nil, err
+	}
+	id, err := attrs.Int("ID")
+	return &assetTag{ID: int(id)}, err
+}
+
+func TestRegistryTypedSegmentTags(t *testing.T) {
+	r := NewRegistry()
+	RegisterTag(r, "#X-ASSET:", decodeAssetTag, TagOptions{Segment: true})
+
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#X-ASSET:ID=1\n#X-ASSET:ID=2\n#EXTINF:10,\na.ts\n#EXTINF:10,\nb.ts\n"
+	p, err := NewMediaPlaylist(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithRegistry(r)
+	if err = p.Decode(*bytes.NewBufferString(src), true); err != nil {
+		t.Fatal(err)
+	}
+	tags := TagsOf[*assetTag](p.Segments[0].Custom, "#X-ASSET:")
+	if len(tags) != 2 || tags[0].ID != 1 || tags[1].ID != 2 {
+		t.Errorf("Got tags %v, expected IDs 1 and 2", tags)
+	}
+	if tag, ok := TagOf[*assetTag](p.Segments[0].Custom, "#X-ASSET:"); !ok || tag.ID != 1 {
+		t.Errorf("Got tag %v, %v, expected ID 1", tag, ok)
+	}
+	if _, ok := TagOf[*assetTag](p.Segments[1].Custom, "#X-ASSET:"); ok {
+		t.Error("Second segment must not have tags")
+	}
+	if !strings.Contains(p.String(), "#X-ASSET:ID=1\n#X-ASSET:ID=2\n#EXTINF") {
+		t.Errorf("Tags are not encoded:\n%s", p.String())
+	}
+}
+
+func TestRegistryNilTypedTag(t *testing.T) {
+	r := NewRegistry()
+	RegisterTag(r, "#X-ASSET:", func(line string) (*assetTag, error) {
+		if strings.HasSuffix(line, "=0") {
+			return nil, nil // skip the line
+		}
+		return decodeAssetTag(line)
+	}, TagOptions{Segment: true})
+	RegisterTag(r, "#X-PLAYLIST:", func(line string) (*assetTag, error) { return nil, nil }, TagOptions{})
+
+	src := "#EXTM3U\n#X-PLAYLIST:1\n#EXT-X-TARGETDURATION:10\n#X-ASSET:ID=0\n#X-ASSET:ID=1\n#EXTINF:10,\na.ts\n"
+	p, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.WithRegistry(r)
+	if err = p.Decode(*bytes.NewBufferString(src), true); err != nil {
+		t.Fatal(err)
+	}
+	if tags := CustomTags(p.Segments[0].Custom, "#X-ASSET:"); len(tags) != 1 || len(p.Custom) != 0 {
+		t.Errorf("Got segment tags %v and playlist tags %v", tags, p.Custom)
+	}
+	if out := p.String(); !strings.Contains(out, "#X-ASSET:ID=1\n#EXTINF") || strings.Contains(out, "ID=0") {
+		t.Errorf("Got playlist\n%s", out)
+	}
+}
+
+func TestRegistryOverridesBuiltinTag(t *testing.T) {
+	type startTag struct{ *lineTagDecoder }
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-START:TIME-OFFSET=5\n#EXTINF:10,\na.ts\n"
+	decodeStart := func(line string) (startTag, error) {
+		return startTag{&lineTagDecoder{name: "#EXT-X-START:", line: line}}, nil
+	}
+	for _, mode := range []DecoderMode{DecodeAlongside, DecodeReplace} {
+		r := NewRegistry()
+		RegisterTag(r, "#EXT-X-START:", decodeStart, TagOptions{Mode: mode})
+		p, _, err := DecodeWith(*bytes.NewBufferString(src), true, r.Decoders())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pp := p.(*MediaPlaylist)
+		if _, ok := TagOf[startTag](pp.Custom, "#EXT-X-START:"); !ok {
+			t.Errorf("Mode %d: custom tag not decoded", mode)
+		}
+		if builtin := pp.StartTime == 5; builtin != (mode == DecodeAlongside) {
+			t.Errorf("Mode %d: built-in handling applied = %v", mode, builtin)
+		}
+	}
+}
+
+func TestRegistryUnregister(t *testing.T) {
+	r := NewRegistry()
+	RegisterTag(r, "#X-ASSET:", decodeAssetTag, TagOptions{})
+	r.Register(&lineTagDecoder{name: "#X-OTHER"})
+	if _, ok := r.Lookup("#X-ASSET:"); !ok {
+		t.Fatal("Registered tag not found")
+	}
+	r.Unregister("#X-ASSET:")
+	if _, ok := r.Lookup("#X-ASSET"); ok {
+		t.Error("Unregistered tag found")
+	}
+	if decoders := r.Decoders(); len(decoders) != 1 || decoders[0].TagName() != "#X-OTHER" {
+		t.Errorf("Got decoders %v", decoders)
+	}
+}
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+	RegisterTag(r, "#X-ASSET:", decodeAssetTag, TagOptions{Segment: true})
+	src := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#X-ASSET:ID=1\n#EXTINF:10,\na.ts\n"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			r.Register(&lineTagDecoder{name: "#X-TAG-" + strconv.Itoa(i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			p, err := NewMediaPlaylist(1, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			p.WithRegistry(r)
+			if err = p.Decode(*bytes.NewBufferString(src), true); err != nil {
+				t.Error(err)
+				return
+			}
+			if _, ok := TagOf[*assetTag](p.Segments[0].Custom, "#X-ASSET:"); !ok {
+				t.Error("Tag not decoded")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(r.Decoders()); n != 9 {
+		t.Errorf("Got %d decoders, expected 9", n)
+	}
+}
@@ -14,6 +14,7 @@ package m3u8
 import (
 	"bytes"
 	"io"
+	"net/url"
 	"time"
 )
 
@@ -37,6 +38,10 @@ const (
 	// playlists. Format for EXT-X-PROGRAM-DATE-TIME defined in
 	// section 3.4.5
 	DATETIME = time.RFC3339Nano
+
+	// DATETIME_MILLIS is the layout of the timestamps with fixed
+	// milliseconds accuracy which is expected by some players.
+	DATETIME_MILLIS = "2006-01-02T15:04:05.000Z07:00"
 )
 
 // ListType is type of the playlist.
@@ -116,7 +121,6 @@ type MediaPlaylist struct {
 	DiscontinuitySeq uint64 // EXT-X-DISCONTINUITY-SEQUENCE
 	StartTime        float64
 	StartTimePrecise bool
-	durationAsInt    bool // output durations as integers of floats?
 	winsize          uint // max number of segments displayed in an encoded playlist; need set to zero for VOD playlists
 	capacity         uint // total capacity of slice used for the playlist
 	head             uint // head of FIFO, we add segments to head
@@ -128,7 +132,11 @@ type MediaPlaylist struct {
 	Map              *Map // EXT-X-MAP is optional tag specifies how to obtain the Media Initialization Section (default map for the playlist)
 	WV               *WV  // Widevine related tags outside of M3U8 specs
 	Custom           map[string]CustomTag
+	customOrder      []string // order of Custom tags for Encode
 	customDecoders   []CustomDecoder
+	registry         *Registry
+	limits           DecodeLimits
+	encoder          EncoderOptions
 }
 
 // MasterPlaylist structure represents a master playlist which
@@ -152,15 +160,21 @@ type MasterPlaylist struct {
 	ver                 uint8
 	independentSegments bool
 	Custom              map[string]CustomTag
+	customOrder         []string // order of Custom tags for Encode
 	customDecoders      []CustomDecoder
+	registry            *Registry
+	limits              DecodeLimits
+	encoder             EncoderOptions
 }
 
 // Variant structure represents variants for master playlist.
 // Variants included in a master playlist and point to media
 // playlists.
 type Variant struct {
-	URI       string
-	Chunklist *MediaPlaylist
+	URI         string
+	Chunklist   *MediaPlaylist
+	Custom      map[string]CustomTag // custom tags placed before EXT-X-STREAM-INF or EXT-X-I-FRAME-STREAM-INF
+	customOrder []string             // order of Custom tags for Encode
 	VariantParams
 }
 
@@ -180,6 +194,7 @@ type VariantParams struct {
 	Iframe           bool   // EXT-X-I-FRAME-STREAM-INF
 	VideoRange       string
 	HDCPLevel        string
+	StableVariantId  string         // STABLE-VARIANT-ID identifies the variant across the reloads of the master playlist
 	FrameRate        float64        // EXT-X-STREAM-INF
 	Alternatives     []*Alternative // EXT-X-MEDIA
 }
@@ -196,6 +211,8 @@ type Alternative struct {
 	Forced          string
 	Characteristics string
 	Subtitles       string
+	Custom          map[string]CustomTag // custom tags placed before EXT-X-MEDIA
+	customOrder     []string             // order of Custom tags for Encode
 }
 
 // MediaSegment structure represents a media segment included in a
@@ -214,6 +231,7 @@ type MediaSegment struct {
 	SCTE            *SCTE     // SCTE-35 used for Ad signaling in HLS
 	ProgramDateTime time.Time // EXT-X-PROGRAM-DATE-TIME tag associates the first sample of a media segment with an absolute date and/or time
 	Custom          map[string]CustomTag
+	customOrder     []string // order of Custom tags for Encode
 }
 
 // SCTE holds custom, non EXT-X-DATERANGE, SCTE-35 tags
@@ -283,7 +301,9 @@ type Playlist interface {
 // CustomDecoder interface for decoding custom and unsupported tags
 type CustomDecoder interface {
 	// TagName should return the full indentifier including the leading '#' as well as the
-	// trailing ':' if the tag also contains a value or attribute list
+	// trailing ':' if the tag also contains a value or attribute list.
+	// Lines are matched to the decoder by the tag name, i.e. the part of
+	// the line before the first ':' or space.
 	TagName() string
 	// Decode parses a line from the playlist and returns the CustomTag representation
 	Decode(line string) (CustomTag, error)
@@ -293,6 +313,49 @@ type CustomDecoder interface {
 	SegmentTag() bool
 }
 
+// DecoderMode defines how ContextDecoder runs together with the
+// built-in handling of the same tag.
+type DecoderMode uint
+
+const (
+	DecodeAlongside DecoderMode = iota // built-in handling of the tag runs after the custom decoder
+	DecodeReplace                      // built-in handling of the tag is skipped
+)
+
+// DecodingContext describes the state of decoding at the line passed to
+// ContextDecoder. The playlists and segments are being built, they must
+// not be modified by the decoder.
+type DecodingContext struct {
+	Line         int                  // number of the decoded line starting from 1
+	Strict       bool                 // decoding is strict
+	Master       *MasterPlaylist      // master playlist being decoded, nil for media playlists
+	Media        *MediaPlaylist       // media playlist being decoded, nil for master playlists
+	SegmentSeqId uint64               // media sequence number of the segment the segment tags will be attached to
+	SegmentTags  map[string]CustomTag // custom tags collected for that segment so far
+	PrevSegment  *MediaSegment        // the last decoded segment, nil if there is no one yet
+}
+
+// ContextDecoder is the extended CustomDecoder which knows the context
+// of the decoded line. It allows stateful decoding, for example
+// depending on the tags of the previous segment.
+type ContextDecoder interface {
+	CustomDecoder
+	// DecodeWithContext is called instead of Decode.
+	DecodeWithContext(ctx *DecodingContext, line string) (CustomTag, error)
+	// Mode declares whether the decoder replaces the built-in
+	// handling of the tag or runs alongside it.
+	Mode() DecoderMode
+}
+
+// VariantTagDecoder may be implemented by CustomDecoder to attach the
+// decoded master playlist tags to the variant or rendition which
+// follows them instead of the master playlist itself.
+type VariantTagDecoder interface {
+	// VariantTag should return true if the tag belongs to the next
+	// EXT-X-STREAM-INF, EXT-X-I-FRAME-STREAM-INF or EXT-X-MEDIA tag.
+	VariantTag() bool
+}
+
 // CustomTag interface for encoding custom and unsupported tags
 type CustomTag interface {
 	// TagName should return the full indentifier including the leading '#' as well as the
@@ -306,9 +369,16 @@ type CustomTag interface {
 	String() string
 }
 
+// CustomTagList holds all the instances of a custom tag which repeats
+// in the same playlist header or segment. It is stored in the Custom
+// maps under the tag name instead of the single tag, so the tags are
+// encoded in the order they were added.
+type CustomTagList []CustomTag
+
 // Internal structure for decoding a line of input stream with a list type detection
 type decodingState struct {
 	listType           ListType
+	skipEmpty          bool // ignore blank lines, used by autodetecting decoder
 	m3u                bool
 	tagWV              bool
 	tagStreamInf       bool
@@ -331,4 +401,17 @@ type decodingState struct {
 	xmap               *Map
 	scte               *SCTE
 	custom             map[string]CustomTag
+	customOrder        []string
+	wv                 *WV
+	decoders           map[string][]CustomDecoder
+	limits             DecodeLimits
+	lines              int
+	expected           int            // number of segments expected by the count of EXTINF tags
+	allocated          int            // number of segments allocated so far
+	segments           []MediaSegment // last allocated block of segments
+	next               int            // index of the next unused segment in the block
+	infLine            int            // line of the last EXTINF
+	lineIndex          LineIndex
+	timeParse          func(value string) (time.Time, error)
+	baseURI            *url.URL
 }
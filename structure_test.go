@@ -60,3 +60,70 @@ func (t *MockCustomTag) String() string {
 func (t *MockCustomTag) SegmentTag() bool {
 	return t.segment
 }
+
+// lineTagDecoder keeps the decoded line as is. Unlike MockCustomTag it
+// returns a new tag for every decoded line.
+type lineTagDecoder struct {
+	name    string
+	segment bool
+	line    string
+}
+
+func (t *lineTagDecoder) TagName() string {
+	return t.name
+}
+
+func (t *lineTagDecoder) Decode(line string) (CustomTag, error) {
+	return &lineTagDecoder{name: t.name, segment: t.segment, line: line}, nil
+}
+
+func (t *lineTagDecoder) Encode() *bytes.Buffer {
+	return bytes.NewBufferString(t.line)
+}
+
+func (t *lineTagDecoder) String() string {
+	return t.line
+}
+
+func (t *lineTagDecoder) SegmentTag() bool {
+	return t.segment
+}
+
+// contextTagDecoder records the contexts it was called with.
+type contextTagDecoder struct {
+	lineTagDecoder
+	mode     DecoderMode
+	contexts []DecodingContext
+}
+
+func (t *contextTagDecoder) Decode(line string) (CustomTag, error) {
+	panic("Decode must not be called for ContextDecoder")
+}
+
+func (t *contextTagDecoder) DecodeWithContext(ctx *DecodingContext, line string) (CustomTag, error) {
+	t.contexts = append(t.contexts, *ctx)
+	return t.lineTagDecoder.Decode(line)
+}
+
+func (t *contextTagDecoder) Mode() DecoderMode {
+	return t.mode
+}
+
+// nilTagDecoder skips all the lines it decodes.
+type nilTagDecoder struct {
+	lineTagDecoder
+}
+
+func (t *nilTagDecoder) Decode(line string) (CustomTag, error) {
+	return nil, nil
+}
+
+// variantTagDecoder attaches decoded tags to the next variant or
+// rendition of master playlist.
+type variantTagDecoder struct {
+	lineTagDecoder
+}
+
+func (t *variantTagDecoder) VariantTag() bool {
+	return true
+}
@@ -0,0 +1,173 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines text marshaling of playlists and tags.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// Text marshaling is strict both ways so whatever MarshalText returns
+// is accepted by UnmarshalText. MarshalText reports the values which
+// can't be encoded with *EncodeError like EncodeStrict, UnmarshalText
+// and ReadFrom return the first syntax error like the strict decoding.
+
+// MarshalText encodes the master playlist with the encoder options of
+// the playlist and validates it like EncodeStrict.
+func (p *MasterPlaylist) MarshalText() ([]byte, error) {
+	buf, err := encodeStrict(&p.encoder, func(buf *encodeWriter) { p.encode(buf, &p.encoder) })
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText replaces the master playlist with the strictly decoded
+// text. The decoders and limits set on the playlist are used and kept.
+func (p *MasterPlaylist) UnmarshalText(text []byte) error {
+	return p.decodeText(bytes.NewBuffer(text))
+}
+
+// ReadFrom reads the whole input and replaces the master playlist with
+// it like UnmarshalText. It returns the number of bytes read.
+func (p *MasterPlaylist) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	buf, err := readLimited(cr, p.limits)
+	if err != nil {
+		return cr.n, err
+	}
+	return cr.n, p.decodeText(buf)
+}
+
+func (p *MasterPlaylist) decodeText(buf *bytes.Buffer) error {
+	decoded := NewMasterPlaylist()
+	decoded.customDecoders = p.customDecoders
+	decoded.registry = p.registry
+	decoded.limits = p.limits
+	decoded.encoder = p.encoder
+	if err := decoded.decode(buf, decoded.decoderOptions(true)); err != nil {
+		return err
+	}
+	*p = *decoded
+	return nil
+}
+
+// MarshalText encodes the media playlist with the encoder options of
+// the playlist and validates it like EncodeStrict.
+func (p *MediaPlaylist) MarshalText() ([]byte, error) {
+	buf, err := encodeStrict(&p.encoder, func(buf *encodeWriter) { p.encode(buf, &p.encoder) })
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalText replaces the media playlist with the strictly decoded
+// text. The window of the decoded playlist covers all its segments.
+// The decoders and limits set on the playlist are used and kept.
+func (p *MediaPlaylist) UnmarshalText(text []byte) error {
+	return p.decodeText(bytes.NewBuffer(text))
+}
+
+// ReadFrom reads the whole input and replaces the media playlist with
+// it like UnmarshalText. It returns the number of bytes read.
+func (p *MediaPlaylist) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: r}
+	buf, err := readLimited(cr, p.limits)
+	if err != nil {
+		return cr.n, err
+	}
+	return cr.n, p.decodeText(buf)
+}
+
+func (p *MediaPlaylist) decodeText(buf *bytes.Buffer) error {
+	decoded, err := NewMediaPlaylist(0, 1024) // capacity auto extends
+	if err != nil {
+		return err
+	}
+	decoded.customDecoders = p.customDecoders
+	decoded.registry = p.registry
+	decoded.limits = p.limits
+	decoded.encoder = p.encoder
+	if err = decoded.decode(buf, decoded.decoderOptions(true)); err != nil {
+		return err
+	}
+	*p = *decoded
+	return nil
+}
+
+// MarshalText encodes the key as the attribute list of EXT-X-KEY.
+func (k *Key) MarshalText() ([]byte, error) {
+	return tagAttributes("#EXT-X-KEY:", func(buf *encodeWriter) { writeKey(buf, k) })
+}
+
+// UnmarshalText decodes the key from the attribute list of EXT-X-KEY
+// with or without the tag name.
+func (k *Key) UnmarshalText(text []byte) error {
+	attrs, err := ParseAttributeList(strings.TrimPrefix(string(text), "#EXT-X-KEY:"))
+	if err != nil {
+		return err
+	}
+	if _, err = attrs.get("METHOD"); err != nil {
+		return err
+	}
+	var key Key
+	decodeKey(&key, attrs)
+	*k = key
+	return nil
+}
+
+// MarshalText encodes the map as the attribute list of EXT-X-MAP.
+func (m *Map) MarshalText() ([]byte, error) {
+	return tagAttributes("#EXT-X-MAP:", func(buf *encodeWriter) { writeMap(buf, m) })
+}
+
+// UnmarshalText decodes the map from the attribute list of EXT-X-MAP
+// with or without the tag name.
+func (m *Map) UnmarshalText(text []byte) error {
+	attrs, err := ParseAttributeList(strings.TrimPrefix(string(text), "#EXT-X-MAP:"))
+	if err != nil {
+		return err
+	}
+	if _, err = attrs.get("URI"); err != nil {
+		return err
+	}
+	var decoded Map
+	if err = decodeMap(&decoded, attrs); err != nil {
+		return err
+	}
+	*m = decoded
+	return nil
+}
+
+// tagAttributes strictly encodes the tag line and returns its
+// attribute list.
+func tagAttributes(tag string, encode func(buf *encodeWriter)) ([]byte, error) {
+	buf, err := encodeStrict(&EncoderOptions{}, encode)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes()[len(tag):], []byte("\n")), nil
+}
+
+// countingReader counts the bytes read from the reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+	return n, err
+}
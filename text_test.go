@@ -0,0 +1,179 @@
+/*
+Text marshaling tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	_ encoding.TextMarshaler   = (*MasterPlaylist)(nil)
+	_ encoding.TextUnmarshaler = (*MasterPlaylist)(nil)
+	_ io.WriterTo              = (*MasterPlaylist)(nil)
+	_ io.ReaderFrom            = (*MasterPlaylist)(nil)
+	_ encoding.TextMarshaler   = (*MediaPlaylist)(nil)
+	_ encoding.TextUnmarshaler = (*MediaPlaylist)(nil)
+	_ io.WriterTo              = (*MediaPlaylist)(nil)
+	_ io.ReaderFrom            = (*MediaPlaylist)(nil)
+	_ encoding.TextMarshaler   = (*Key)(nil)
+	_ encoding.TextUnmarshaler = (*Key)(nil)
+	_ encoding.TextMarshaler   = (*Map)(nil)
+	_ encoding.TextUnmarshaler = (*Map)(nil)
+	_ encoding.TextMarshaler   = Attribute{}
+	_ encoding.TextUnmarshaler = (*Attribute)(nil)
+	_ encoding.TextMarshaler   = AttributeList{}
+	_ encoding.TextUnmarshaler = (*AttributeList)(nil)
+)
+
+func TestMediaPlaylistText(t *testing.T) {
+	src, err := os.ReadFile("sample-playlists/media-playlist-with-program-date-time.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p MediaPlaylist
+	if err = p.UnmarshalText(src); err != nil {
+		t.Fatal(err)
+	}
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != p.String() {
+		t.Errorf("Got text\n%s\nexpected\n%s", text, p.String())
+	}
+
+	// the playlist is replaced, not appended to
+	n, err := p.ReadFrom(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(text)) {
+		t.Errorf("Read %d bytes, expected %d", n, len(text))
+	}
+	if p.String() != string(text) {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", p.String(), text)
+	}
+
+	if err = p.UnmarshalText([]byte("#EXTM3U\n#EXTINF:abc,\na.ts\n")); err == nil {
+		t.Error("Invalid playlist is decoded without error")
+	}
+
+	p.SetDefaultKey("AES-128", "key.bin", "1234", "", "")
+	var encodeErr *EncodeError
+	if _, err = p.MarshalText(); !errors.As(err, &encodeErr) || encodeErr.Tag != "#EXT-X-KEY" {
+		t.Errorf("Got error %v for invalid IV", err)
+	}
+}
+
+func TestMasterPlaylistText(t *testing.T) {
+	src, err := os.ReadFile("sample-playlists/master-with-alternatives.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewMasterPlaylist()
+	n, err := p.ReadFrom(strings.NewReader(string(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(src)) {
+		t.Errorf("Read %d bytes, expected %d", n, len(src))
+	}
+	text, err := p.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewMasterPlaylist()
+	if err = restored.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if restored.String() != string(text) || len(restored.Variants) != len(p.Variants) {
+		t.Errorf("Got playlist\n%s\nexpected\n%s", restored, text)
+	}
+
+	p.WithLimits(DecodeLimits{MaxBytes: 10})
+	if _, err = p.ReadFrom(strings.NewReader(string(src))); !errors.Is(err, ErrTooManyBytes) {
+		t.Errorf("Got error %v, expected %v", err, ErrTooManyBytes)
+	}
+}
+
+func TestKeyAndMapText(t *testing.T) {
+	key := Key{Method: "AES-128", URI: "https://example.com/key", IV: "0x10", Keyformat: "identity"}
+	text, err := key.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `METHOD=AES-128,URI="https://example.com/key",IV=0x10,KEYFORMAT="identity"`
+	if string(text) != expected {
+		t.Errorf("Got key %s, expected %s", text, expected)
+	}
+
+	// keys are usable as flag values
+	var restored Key
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.TextVar(&restored, "key", &Key{Method: "NONE"}, "encryption key")
+	if err = fs.Parse([]string{"-key", "#EXT-X-KEY:" + expected}); err != nil {
+		t.Fatal(err)
+	}
+	if restored != key {
+		t.Errorf("Got key %+v, expected %+v", restored, key)
+	}
+	if err = restored.UnmarshalText([]byte(`URI="a"`)); !errors.Is(err, ErrNoAttribute) {
+		t.Errorf("Got error %v for key without method", err)
+	}
+
+	m := Map{URI: "init.mp4", Limit: 100, Offset: 10}
+	if text, err = m.MarshalText(); err != nil || string(text) != `URI="init.mp4",BYTERANGE=100@10` {
+		t.Errorf("Got map %s, %v", text, err)
+	}
+	var restoredMap Map
+	if err = restoredMap.UnmarshalText(text); err != nil || restoredMap != m {
+		t.Errorf("Got map %+v, %v", restoredMap, err)
+	}
+	if err = restoredMap.UnmarshalText([]byte(`URI="a",BYTERANGE=x`)); err == nil {
+		t.Error("Map with invalid byte range is decoded without error")
+	}
+	if _, err = (&Map{URI: "a\nb"}).MarshalText(); err == nil {
+		t.Error("Map with invalid URI is encoded without error")
+	}
+}
+
+func TestAttributeText(t *testing.T) {
+	var list AttributeList
+	src := `BANDWIDTH=1000,CODECS="avc1.4d401e,mp4a.40.2",RESOLUTION=640x360`
+	if err := list.UnmarshalText([]byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 || !list[1].Quoted {
+		t.Fatalf("Got attributes %+v", list)
+	}
+	if text, err := list.MarshalText(); err != nil || string(text) != src {
+		t.Errorf("Got attributes %s, %v", text, err)
+	}
+	if err := list.UnmarshalText([]byte(`A="unterminated`)); !errors.Is(err, ErrAttributeSyntax) || len(list) != 3 {
+		t.Errorf("Got error %v and attributes %+v", err, list)
+	}
+
+	var a Attribute
+	if err := a.UnmarshalText([]byte(`NAME="English"`)); err != nil || a.Name != "NAME" || a.Value != "English" || !a.Quoted {
+		t.Errorf("Got attribute %+v, %v", a, err)
+	}
+	if err := a.UnmarshalText([]byte(`A=1,B=2`)); !errors.Is(err, ErrAttributeSyntax) {
+		t.Errorf("Got error %v for two attributes", err)
+	}
+	if _, err := (Attribute{Name: "A", Value: "1,2"}).MarshalText(); !errors.Is(err, ErrInvalidAttribute) {
+		t.Errorf("Got error %v for unquoted value with comma", err)
+	}
+}
@@ -0,0 +1,116 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines the timeline of media playlist segments.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"sort"
+	"time"
+)
+
+// TimelineSegment is a media segment placed on the timeline.
+type TimelineSegment struct {
+	Segment          *MediaSegment
+	Start            time.Duration // offset from the start of the first segment
+	End              time.Duration // cumulative duration up to the end of the segment
+	DiscontinuitySeq uint64        // discontinuity sequence number of the segment
+	ProgramDateTime  time.Time     // effective program date time, zero if unknown (see MediaPlaylist.ProgramDateTimes)
+}
+
+// Timeline indexes the segments of a media playlist by time and by
+// sequence number. The lookups use binary search so they stay fast
+// for the long DVR playlists. The timeline is a snapshot: it must be
+// rebuilt after the segments of the playlist change.
+type Timeline struct {
+	segments []TimelineSegment
+	dated    []int // indexes of the segments with known program date time
+}
+
+// NewTimeline builds the timeline of all the segments of the playlist
+// in the order they were added. The discontinuity sequence numbers
+// start from EXT-X-DISCONTINUITY-SEQUENCE of the playlist and grow
+// with each segment marked by EXT-X-DISCONTINUITY, the same way the
+// sequence grows when such segments are removed from the playlist.
+func NewTimeline(p *MediaPlaylist) *Timeline {
+	segments := p.segments()
+	pdts := programDateTimes(segments)
+	t := &Timeline{segments: make([]TimelineSegment, len(segments))}
+	var (
+		end float64 // summed in seconds to not accumulate rounding
+		dsn = p.DiscontinuitySeq
+	)
+	for i, seg := range segments {
+		if seg.Discontinuity != nil {
+			dsn++
+		}
+		start := end
+		end += seg.Duration
+		t.segments[i] = TimelineSegment{
+			Segment:          seg,
+			Start:            seconds(start),
+			End:              seconds(end),
+			DiscontinuitySeq: dsn,
+			ProgramDateTime:  pdts[i],
+		}
+		if !pdts[i].IsZero() {
+			t.dated = append(t.dated, i)
+		}
+	}
+	return t
+}
+
+// Len returns the number of segments on the timeline.
+func (t *Timeline) Len() int {
+	return len(t.segments)
+}
+
+// Segments returns the segments on the timeline. The slice must not
+// be modified.
+func (t *Timeline) Segments() []TimelineSegment {
+	return t.segments
+}
+
+// TotalDuration returns the summary duration of the segments.
+func (t *Timeline) TotalDuration() time.Duration {
+	if len(t.segments) == 0 {
+		return 0
+	}
+	return t.segments[len(t.segments)-1].End
+}
+
+// SegmentAt returns the segment playing at the offset from the start
+// of the first segment. The offset at the boundary belongs to the next
+// segment. The result is false when the offset is out of the
+// timeline.
+func (t *Timeline) SegmentAt(offset time.Duration) (TimelineSegment, bool) {
+	if offset < 0 {
+		return TimelineSegment{}, false
+	}
+	i := sort.Search(len(t.segments), func(i int) bool {
+		return t.segments[i].End > offset
+	})
+	if i == len(t.segments) {
+		return TimelineSegment{}, false
+	}
+	return t.segments[i], true
+}
+
+// SegmentBySeqID returns the segment with the media sequence number.
+// The result is false when there is no such segment on the timeline.
+func (t *Timeline) SegmentBySeqID(id uint64) (TimelineSegment, bool) {
+	i := sort.Search(len(t.segments), func(i int) bool {
+		return t.segments[i].Segment.SeqId >= id
+	})
+	if i == len(t.segments) || t.segments[i].Segment.SeqId != id {
+		return TimelineSegment{}, false
+	}
+	return t.segments[i], true
+}
@@ -0,0 +1,115 @@
+/*
+Playlist timeline tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTimeline(t *testing.T) {
+	p := decodeMedia(t, `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:50
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-DISCONTINUITY
+#EXTINF:10,
+s50.ts
+#EXTINF:9.5,
+s51.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:6,
+s52.ts
+#EXTINF:6,
+s53.ts
+`)
+	tl := NewTimeline(p)
+	if tl.Len() != 4 || tl.TotalDuration() != 31500*time.Millisecond {
+		t.Fatalf("Got %d segments of %v", tl.Len(), tl.TotalDuration())
+	}
+	for _, c := range []struct {
+		offset time.Duration
+		uri    string
+		start  time.Duration
+		dsn    uint64
+	}{
+		{0, "s50.ts", 0, 4},
+		{10 * time.Second, "s51.ts", 10 * time.Second, 4},
+		{19 * time.Second, "s51.ts", 10 * time.Second, 4},
+		{19500 * time.Millisecond, "s52.ts", 19500 * time.Millisecond, 5},
+		{31 * time.Second, "s53.ts", 25500 * time.Millisecond, 5},
+	} {
+		seg, ok := tl.SegmentAt(c.offset)
+		if !ok || seg.Segment.URI != c.uri || seg.Start != c.start || seg.DiscontinuitySeq != c.dsn {
+			t.Errorf("Got segment %+v, %v at %v", seg, ok, c.offset)
+		}
+	}
+	for _, offset := range []time.Duration{-time.Second, 31500 * time.Millisecond} {
+		if seg, ok := tl.SegmentAt(offset); ok {
+			t.Errorf("Got segment %+v out of the timeline at %v", seg, offset)
+		}
+	}
+	if seg, ok := tl.SegmentBySeqID(52); !ok || seg.Segment.URI != "s52.ts" || seg.End != 25500*time.Millisecond {
+		t.Errorf("Got segment %+v, %v", seg, ok)
+	}
+	for _, id := range []uint64{49, 54} {
+		if seg, ok := tl.SegmentBySeqID(id); ok {
+			t.Errorf("Got segment %+v for sequence number %d", seg, id)
+		}
+	}
+}
+
+func TestTimelineRingOrder(t *testing.T) {
+	p, err := NewMediaPlaylist(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if i >= 3 {
+			p.Remove()
+		}
+		if err = p.Append(fmt.Sprintf("t%02d.ts", i), float64(i+1), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tl := NewTimeline(p)
+	var uris []string
+	for _, seg := range tl.Segments() {
+		uris = append(uris, seg.Segment.URI)
+	}
+	if fmt.Sprint(uris) != "[t02.ts t03.ts t04.ts]" || tl.TotalDuration() != 12*time.Second {
+		t.Errorf("Got segments %v of %v", uris, tl.TotalDuration())
+	}
+	if seg, ok := tl.SegmentAt(4 * time.Second); !ok || seg.Segment.URI != "t03.ts" {
+		t.Errorf("Got segment %+v, %v", seg, ok)
+	}
+	if seg, ok := tl.SegmentBySeqID(4); !ok || seg.Start != 7*time.Second {
+		t.Errorf("Got segment %+v, %v", seg, ok)
+	}
+	if NewTimeline(new(MediaPlaylist)).TotalDuration() != 0 {
+		t.Error("Empty timeline has duration")
+	}
+}
+
+func BenchmarkTimelineSegmentAt(b *testing.B) {
+	p, err := NewMediaPlaylist(0, 50000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 50000; i++ {
+		_ = p.Append(fmt.Sprintf("s%d.ts", i), 6, "")
+	}
+	tl := NewTimeline(p)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tl.SegmentAt(time.Duration(i%300000) * time.Second)
+	}
+}
@@ -0,0 +1,185 @@
+package m3u8
+
+/*
+ Part of M3U8 parser & generator library.
+ This file defines validation of playlists against RFC 8216.
+
+ Copyright 2013-2019 The Project Developers.
+ See the AUTHORS and LICENSE files at the top-level directory of this distribution
+ and at https://github.com/grafov/m3u8/
+
+ ॐ तारे तुत्तारे तुरे स्व
+*/
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+)
+
+// Severity of the violation.
+type Severity int
+
+const (
+	// SeverityError is violation of MUST requirement of the spec.
+	SeverityError Severity = iota
+	// SeverityWarning is violation of SHOULD requirement or the
+	// content which is likely wrong.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// Rules checked by Validate.
+const (
+	RuleTargetDuration = "target-duration" // EXTINF rounded to integer exceeds EXT-X-TARGETDURATION, section 4.3.3.1
+	RuleVersion        = "version"         // EXT-X-VERSION is lower than the features require, section 7
+	RuleIframesOnly    = "i-frames-only"   // I-frame segment without byte range, or fMP4 one without media initialization section, section 4.3.3.6
+	RuleGroupID        = "group-id"        // group of renditions referenced by variant doesn't exist, section 4.3.4.2
+	RuleDefault        = "default"         // more than one rendition of the group has DEFAULT=YES, section 4.3.4.1.1
+	RuleBandwidth      = "bandwidth"       // BANDWIDTH attribute is absent, section 4.3.4.2
+	RuleName           = "name"            // NAME of renditions repeats within the group, section 4.3.4.1.1
+)
+
+// Violation is the finding of Validate. Object points to the
+// offending part of the playlist: *MediaPlaylist, *MediaSegment,
+// *MasterPlaylist, *Variant or *Alternative.
+type Violation struct {
+	Rule     string
+	Severity Severity
+	Object   interface{}
+	Message  string
+}
+
+func (v Violation) Error() string {
+	return v.Severity.String() + ": " + v.Rule + ": " + v.Message
+}
+
+// Validate checks the media playlist against RFC 8216 and returns all
+// the violations found in the segments of the window. It returns nil
+// for valid playlist.
+func (p *MediaPlaylist) Validate() []Violation {
+	var violations []Violation
+	add := func(rule string, severity Severity, object interface{}, format string, args ...interface{}) {
+		violations = append(violations, Violation{rule, severity, object, fmt.Sprintf(format, args...)})
+	}
+
+	// durations written as integers are allowed by any version
+	required := p.requiredVersion(&EncoderOptions{DurationAsInt: true})
+	target := int64(math.Ceil(p.TargetDuration))
+	p.forEachSegment(func(seg *MediaSegment) {
+		if int64(math.Round(seg.Duration)) > target {
+			add(RuleTargetDuration, SeverityError, seg, "segment %d duration %v exceeds target duration %d", seg.SeqId, seg.Duration, target)
+		}
+		if seg.Duration != math.Trunc(seg.Duration) {
+			version(&required, 3)
+		}
+		if p.Iframe {
+			if seg.Limit <= 0 {
+				add(RuleIframesOnly, SeverityWarning, seg, "I-frame segment %d has no byte range", seg.SeqId)
+			}
+			if p.Map == nil && seg.Map == nil && fragmentedMP4(seg.URI) {
+				add(RuleIframesOnly, SeverityWarning, seg, "I-frame segment %d has no EXT-X-MAP", seg.SeqId)
+			}
+		}
+	})
+	if p.ver < required {
+		add(RuleVersion, SeverityError, p, "version %d is declared but the features require version %d", p.ver, required)
+	}
+	return violations
+}
+
+// fragmentedMP4 tells whether the segment URI looks like fragmented
+// MPEG-4 which needs the media initialization section unlike MPEG-TS.
+func fragmentedMP4(uri string) bool {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	switch strings.ToLower(path.Ext(uri)) {
+	case ".mp4", ".m4s", ".m4v", ".m4a", ".cmfv", ".cmfa":
+		return true
+	}
+	return false
+}
+
+// Validate checks the master playlist against RFC 8216 and returns all
+// the violations found. It returns nil for valid playlist.
+func (p *MasterPlaylist) Validate() []Violation {
+	var violations []Violation
+	add := func(rule string, severity Severity, object interface{}, format string, args ...interface{}) {
+		violations = append(violations, Violation{rule, severity, object, fmt.Sprintf(format, args...)})
+	}
+
+	// renditions are collected the same way as Encode writes them
+	type group struct{ typ, id string }
+	var (
+		alternatives []*Alternative
+		written      = make(map[string]bool)
+		groups       = make(map[group]bool)
+	)
+	for _, v := range p.Variants {
+		for _, alt := range v.Alternatives {
+			if alt == nil {
+				continue
+			}
+			altKey := fmt.Sprintf("%s-%s-%s-%s", alt.Type, alt.GroupId, alt.Name, alt.Language)
+			if written[altKey] {
+				continue
+			}
+			written[altKey] = true
+			alternatives = append(alternatives, alt)
+			groups[group{alt.Type, alt.GroupId}] = true
+		}
+	}
+
+	for _, v := range p.Variants {
+		tag := "EXT-X-STREAM-INF"
+		if v.Iframe {
+			tag = "EXT-X-I-FRAME-STREAM-INF"
+		}
+		if v.Bandwidth == 0 {
+			add(RuleBandwidth, SeverityError, v, "%s of %s has no BANDWIDTH", tag, v.URI)
+		}
+		refs := []group{{"AUDIO", v.Audio}, {"VIDEO", v.Video}, {"SUBTITLES", v.Subtitles}, {"CLOSED-CAPTIONS", v.Captions}}
+		for _, ref := range refs {
+			if ref.id == "" || ref.typ == "CLOSED-CAPTIONS" && ref.id == "NONE" {
+				continue
+			}
+			if !groups[ref] {
+				add(RuleGroupID, SeverityError, v, "%s of %s refers to %s group %q without EXT-X-MEDIA", tag, v.URI, ref.typ, ref.id)
+			}
+		}
+	}
+
+	defaults := make(map[group]int)
+	names := make(map[group]map[string]bool)
+	for _, alt := range alternatives {
+		g := group{alt.Type, alt.GroupId}
+		if alt.Default {
+			if defaults[g]++; defaults[g] == 2 {
+				add(RuleDefault, SeverityError, alt, "%s group %q has more than one rendition with DEFAULT=YES", alt.Type, alt.GroupId)
+			}
+		}
+		if names[g] == nil {
+			names[g] = make(map[string]bool)
+		}
+		if names[g][alt.Name] {
+			add(RuleName, SeverityError, alt, "%s group %q has more than one rendition named %q", alt.Type, alt.GroupId, alt.Name)
+		}
+		names[g][alt.Name] = true
+	}
+
+	if required := p.RequiredVersion(); p.ver < required {
+		add(RuleVersion, SeverityError, p, "version %d is declared but the features require version %d", p.ver, required)
+	}
+	return violations
+}
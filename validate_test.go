@@ -0,0 +1,144 @@
+/*
+Playlist validation tests.
+
+Copyright 2013-2019 The Project Developers.
+See the AUTHORS and LICENSE files at the top-level directory of this distribution
+and at https://github.com/grafov/m3u8/
+
+ॐ तारे तुत्तारे तुरे स्व
+*/
+package m3u8
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rules returns the rules of the violations.
+func rules(violations []Violation) []string {
+	var list []string
+	for _, v := range violations {
+		list = append(list, v.Rule)
+	}
+	return list
+}
+
+func TestValidateSamplePlaylists(t *testing.T) {
+	// samples with deliberately broken content
+	invalid := map[string]bool{
+		"sample-playlists/master-with-i-frame-stream-inf.m3u8": true,
+	}
+	files, err := filepath.Glob("sample-playlists/*.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, listType, err := DecodeFrom(bufio.NewReader(f), false)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		var violations []Violation
+		if listType == MASTER {
+			violations = p.(*MasterPlaylist).Validate()
+		} else {
+			violations = p.(*MediaPlaylist).Validate()
+		}
+		found := 0
+		for _, v := range violations {
+			if v.Severity == SeverityError {
+				found++
+				if !invalid[file] {
+					t.Errorf("%s: %v", file, v)
+				}
+			}
+		}
+		if invalid[file] && found == 0 {
+			t.Errorf("%s: no violations found", file)
+		}
+	}
+}
+
+func TestValidateMediaPlaylist(t *testing.T) {
+	media, err := NewMediaPlaylist(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	media.Iframe = true
+	media.Append("a.ts", 10.4, "")
+	media.Append("b.ts", 10.5, "")
+	media.Append("c.m4s?token=1", 4, "")
+	media.Segments[2].Limit = 1000
+	media.TargetDuration = 10
+	violations := media.Validate()
+	expected := []string{
+		RuleIframesOnly,                     // a.ts without range, MPEG-TS doesn't need map
+		RuleTargetDuration, RuleIframesOnly, // b.ts
+		RuleIframesOnly, // fMP4 c.m4s without map
+		RuleVersion,
+	}
+	if got := rules(violations); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Got violations %v, expected %v", got, expected)
+	}
+	if seg := violations[1].Object.(*MediaSegment); seg.URI != "b.ts" || violations[1].Severity != SeverityError {
+		t.Errorf("Unexpected violation %+v", violations[1])
+	}
+	if !strings.Contains(violations[3].Message, "EXT-X-MAP") {
+		t.Errorf("Unexpected violation %v", violations[3])
+	}
+	if violations[4].Object != media || !strings.Contains(violations[4].Error(), "require version 4") {
+		t.Errorf("Unexpected violation %v", violations[4])
+	}
+
+	valid, err := NewMediaPlaylist(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid.Append("a.ts", 9.5, "")
+	if violations := valid.Validate(); violations != nil {
+		t.Errorf("Got violations %v for valid playlist", violations)
+	}
+
+	// the decoder keeps the declared version
+	decoded := decodeMedia(t, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXT-X-BYTERANGE:100@0\n#EXTINF:10,\na.ts\n")
+	if got := rules(decoded.Validate()); len(got) != 1 || got[0] != RuleVersion {
+		t.Errorf("Got violations %v, expected %s", got, RuleVersion)
+	}
+}
+
+func TestValidateMasterPlaylist(t *testing.T) {
+	src := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",DEFAULT=YES,URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="de",DEFAULT=YES,URI="de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac",SUBTITLES="subs"
+low.m3u8
+#EXT-X-STREAM-INF:AUDIO="aac",CLOSED-CAPTIONS=NONE
+high.m3u8
+`
+	p, _, err := DecodeFrom(strings.NewReader(src), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := p.(*MasterPlaylist)
+	violations := master.Validate()
+	expected := []string{RuleGroupID, RuleBandwidth, RuleDefault, RuleName}
+	if got := rules(violations); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Fatalf("Got violations %v, expected %v", got, expected)
+	}
+	if v := violations[0].Object.(*Variant); v.URI != "low.m3u8" {
+		t.Errorf("Group violation of %s, expected low.m3u8", v.URI)
+	}
+	if v := violations[1].Object.(*Variant); v.URI != "high.m3u8" {
+		t.Errorf("Bandwidth violation of %s, expected high.m3u8", v.URI)
+	}
+	if alt := violations[3].Object.(*Alternative); alt.Language != "de" {
+		t.Errorf("Name violation of %+v", alt)
+	}
+}
@@ -12,10 +12,14 @@ package m3u8
 */
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +28,195 @@ import (
 // ErrPlaylistFull declares the playlist error.
 var ErrPlaylistFull = errors.New("playlist is full")
 
+// EncodeError describes the value which can't be encoded without
+// breaking the playlist syntax (RFC 8216 section 4).
+type EncodeError struct {
+	Tag string // tag or line of the playlist
+	Err error
+}
+
+func (e *EncodeError) Error() string {
+	return "can't encode " + e.Tag + ": " + e.Err.Error()
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// EncoderOptions configures the output of Encode. The zero value
+// keeps the default output of the library.
+type EncoderOptions struct {
+	DurationPrecision int    // digits after the point in EXTINF durations, 3 when zero, the shortest exact form when negative
+	DurationAsInt     bool   // round EXTINF durations up to integers
+	PDTLayout         string // layout of EXT-X-PROGRAM-DATE-TIME, DATETIME when empty
+	PDTUTC            bool   // convert EXT-X-PROGRAM-DATE-TIME to UTC
+	OmitDeprecated    bool   // don't write the attributes removed from the spec, such as PROGRAM-ID which is never written since version 6
+	CRLF              bool   // end lines with CR LF instead of LF
+	Strict            bool   // stop on the values which break the syntax as EncodeStrict does, WriteTo only as Encode can't fail
+	Version           uint8  // pins EXT-X-VERSION instead of computing it, a version below the one required by the content is reported in Strict mode and raised to it otherwise
+}
+
+// formatDuration formats duration of the segment for EXTINF.
+func (o *EncoderOptions) formatDuration(duration float64) string {
+	if o.DurationAsInt {
+		// Old Android players has problems with non integer Duration.
+		return strconv.FormatInt(int64(math.Ceil(duration)), 10)
+	}
+	// Wowza Mediaserver and some others prefer floats.
+	prec := o.DurationPrecision
+	switch {
+	case prec == 0:
+		prec = 3
+	case prec < 0:
+		prec = -1
+	}
+	return strconv.FormatFloat(duration, 'f', prec, 64)
+}
+
+// formatTime formats the time for EXT-X-PROGRAM-DATE-TIME.
+func (o *EncoderOptions) formatTime(t time.Time) string {
+	if o.PDTUTC {
+		t = t.UTC()
+	}
+	if o.PDTLayout == "" {
+		return t.Format(DATETIME)
+	}
+	return t.Format(o.PDTLayout)
+}
+
+// newline returns the line ending.
+func (o *EncoderOptions) newline() string {
+	if o.CRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// encodeWriter is the output of the encoder. It keeps the first error
+// so the encoder doesn't check errors after each write and stops to
+// write after it. The error is also set when the context is done.
+type encodeWriter struct {
+	ctx    context.Context
+	out    stringWriter
+	crlf   bool
+	strict bool // validate the values, see EncodeStrict
+	err    error
+}
+
+type stringWriter interface {
+	io.Writer
+	io.StringWriter
+}
+
+func newEncodeWriter(ctx context.Context, out stringWriter, opts *EncoderOptions) *encodeWriter {
+	return &encodeWriter{ctx: ctx, out: out, crlf: opts.CRLF}
+}
+
+func (w *encodeWriter) WriteString(s string) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.crlf && strings.IndexByte(s, '\n') >= 0 {
+		s = strings.ReplaceAll(s, "\n", "\r\n")
+	}
+	var n int
+	n, w.err = w.out.WriteString(s)
+	return n, w.err
+}
+
+func (w *encodeWriter) WriteRune(r rune) (int, error) {
+	return w.WriteString(string(r))
+}
+
+// attributes returns the writer of the attribute list of the tag.
+func (w *encodeWriter) attributes() *AttributeWriter {
+	if w.strict {
+		return NewStrictAttributeWriter(w)
+	}
+	return NewAttributeWriter(w)
+}
+
+// endTag ends the line of the tag with the attribute list.
+func (w *encodeWriter) endTag(tag string, attrs *AttributeWriter) {
+	if err := attrs.Err(); err != nil && w.err == nil {
+		w.invalid(tag, err)
+	}
+	w.WriteRune('\n')
+}
+
+// invalid stops the strict encoding with the error of the tag.
+func (w *encodeWriter) invalid(tag string, err error) {
+	if w.strict && w.err == nil {
+		w.err = &EncodeError{Tag: tag, Err: err}
+	}
+}
+
+// checkText checks that the value written as is doesn't break the line.
+func (w *encodeWriter) checkText(tag, name, value string) {
+	if w.strict && strings.ContainsAny(value, "\r\n") {
+		w.invalid(tag, fmt.Errorf("%s %q contains line break", name, value))
+	}
+}
+
+// checkURI checks the URI line or URI attribute.
+func (w *encodeWriter) checkURI(tag, uri string) {
+	if w.strict && uri == "" {
+		w.invalid(tag, errors.New("URI is empty"))
+		return
+	}
+	w.checkText(tag, "URI", uri)
+}
+
+// done reports whether the encoding should be stopped.
+func (w *encodeWriter) done() bool {
+	if w.err == nil {
+		w.err = w.ctx.Err()
+	}
+	return w.err != nil
+}
+
+// countingWriter counts bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// encodeStrict encodes the playlist by the encode function with the
+// validation of the values.
+func encodeStrict(opts *EncoderOptions, encode func(*encodeWriter)) (*bytes.Buffer, error) {
+	buf := new(bytes.Buffer)
+	ew := newEncodeWriter(context.Background(), buf, opts)
+	ew.strict = true
+	encode(ew)
+	if ew.err != nil {
+		return nil, ew.err
+	}
+	return buf, nil
+}
+
+// writeTo streams the playlist encoded by the encode function to the
+// writer.
+func writeTo(ctx context.Context, w io.Writer, opts *EncoderOptions, encode func(*encodeWriter)) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	ew := newEncodeWriter(ctx, bw, opts)
+	ew.strict = opts.Strict
+	if !ew.done() {
+		encode(ew)
+	}
+	if ew.err != nil {
+		return cw.n, ew.err
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
 // Set version of the playlist accordingly with section 7
 func version(ver *uint8, newver uint8) {
 	if *ver < newver {
@@ -35,6 +228,113 @@ func strver(ver uint8) string {
 	return strconv.FormatUint(uint64(ver), 10)
 }
 
+// writeVersion writes EXT-X-VERSION tag and returns the written
+// version. The version is either pinned by the options or the higher
+// of the playlist version and the version required by its content.
+// The pinned version is never written below the required one.
+func writeVersion(buf *encodeWriter, opts *EncoderOptions, ver, required uint8) uint8 {
+	switch {
+	case opts.Version == 0:
+		version(&ver, required)
+	case opts.Version < required:
+		buf.invalid("#EXT-X-VERSION", fmt.Errorf("version %d is pinned but the content requires version %d", opts.Version, required))
+		ver = required
+	default:
+		ver = opts.Version
+	}
+	buf.WriteString("#EXT-X-VERSION:")
+	buf.WriteString(strver(ver))
+	buf.WriteRune('\n')
+	return ver
+}
+
+// keyVersion returns the version required for the key accordingly with
+// section 7.
+func keyVersion(key *Key) uint8 {
+	switch {
+	case key == nil:
+		return 1
+	case key.Keyformat != "" || key.Keyformatversions != "":
+		return 5
+	case key.IV != "":
+		return 2
+	}
+	return 1
+}
+
+// RequiredVersion returns the minimal protocol version required by
+// the content of the master playlist accordingly with section 7 of
+// RFC 8216. The features of master playlists are compatible with all
+// the versions, so it is always 1.
+func (p *MasterPlaylist) RequiredVersion() uint8 {
+	return 1
+}
+
+// RequiredVersion returns the minimal protocol version required by
+// the segments in the window and the tags of the media playlist
+// accordingly with section 7 of RFC 8216.
+func (p *MediaPlaylist) RequiredVersion() uint8 {
+	return p.requiredVersion(&p.encoder)
+}
+
+func (p *MediaPlaylist) requiredVersion(opts *EncoderOptions) uint8 {
+	ver := uint8(1)
+	if !opts.DurationAsInt {
+		version(&ver, 3) // floating-point EXTINF duration values
+	}
+	mapVersion := uint8(6) // EXT-X-MAP in a playlist without EXT-X-I-FRAMES-ONLY
+	if p.Iframe {
+		version(&ver, 4)
+		mapVersion = 5
+	}
+	version(&ver, keyVersion(p.Key))
+	if p.Map != nil {
+		version(&ver, mapVersion)
+	}
+	p.forEachSegment(func(seg *MediaSegment) {
+		if seg.Limit > 0 {
+			version(&ver, 4)
+		}
+		if seg.Key != nil && p.Key != seg.Key {
+			version(&ver, keyVersion(seg.Key))
+		}
+		if p.Map == nil && seg.Map != nil {
+			version(&ver, mapVersion)
+		}
+	})
+	return ver
+}
+
+// forEachSegment calls the function for the segments of the window in
+// the order of Encode.
+func (p *MediaPlaylist) forEachSegment(fn func(seg *MediaSegment)) {
+	head := p.head
+	count := p.count
+	for i := uint(0); (i < p.winsize || p.winsize == 0) && count > 0; count-- {
+		seg := p.Segments[head]
+		head = (head + 1) % p.capacity
+		if seg == nil { // protection from badly filled chunklists
+			continue
+		}
+		if p.winsize > 0 { // skip for VOD playlists, where winsize = 0
+			i++
+		}
+		fn(seg)
+	}
+}
+
+// segments returns all the segments of the ring buffer from the first
+// to the last one regardless of the window.
+func (p *MediaPlaylist) segments() []*MediaSegment {
+	segments := make([]*MediaSegment, 0, p.count)
+	for i := uint(0); i < p.count; i++ {
+		if seg := p.Segments[(p.head+i)%p.capacity]; seg != nil {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
+
 // NewMasterPlaylist creates a new empty master playlist. Master
 // playlist consists of variants.
 func NewMasterPlaylist() *MasterPlaylist {
@@ -74,28 +374,72 @@ func (p *MasterPlaylist) Encode() *bytes.Buffer {
 	if p.buf.Len() > 0 {
 		return &p.buf
 	}
+	p.encode(newEncodeWriter(context.Background(), &p.buf, &p.encoder), &p.encoder)
+	return &p.buf
+}
+
+// EncodeWithOptions generates the output in M3U8 format with the
+// options. Unlike Encode it doesn't use and doesn't fill the cache.
+func (p *MasterPlaylist) EncodeWithOptions(opts EncoderOptions) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	p.encode(newEncodeWriter(context.Background(), buf, &opts), &opts)
+	return buf
+}
 
-	p.buf.WriteString("#EXTM3U\n#EXT-X-VERSION:")
-	p.buf.WriteString(strver(p.ver))
-	p.buf.WriteRune('\n')
+// EncodeStrict generates the output in M3U8 format like Encode but
+// checks the values against the playlist syntax of RFC 8216 as it
+// writes them. It returns EncodeError for the first value which would
+// break the playlist, for example a quoted string with double quotes
+// or line breaks, and no output at all. The cache is not used.
+func (p *MasterPlaylist) EncodeStrict() (*bytes.Buffer, error) {
+	opts := p.encoder
+	return encodeStrict(&opts, func(ew *encodeWriter) { p.encode(ew, &opts) })
+}
+
+// WriteTo writes the playlist in M3U8 format to the writer. Unlike
+// Encode it streams the output without building it in memory and
+// doesn't use the cache. It returns the number of bytes written and
+// the first write error.
+func (p *MasterPlaylist) WriteTo(w io.Writer) (int64, error) {
+	return p.WriteToContext(context.Background(), w)
+}
+
+// WriteToContext works like WriteTo but stops writing with the
+// context error as soon as the context is done.
+func (p *MasterPlaylist) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	opts := p.encoder
+	return writeTo(ctx, w, &opts, func(ew *encodeWriter) { p.encode(ew, &opts) })
+}
+
+// SetEncoderOptions sets the options used by Encode. This operation
+// does reset playlist cache.
+func (p *MasterPlaylist) SetEncoderOptions(opts EncoderOptions) {
+	p.encoder = opts
+	p.buf.Reset()
+}
+
+func (p *MasterPlaylist) encode(buf *encodeWriter, opts *EncoderOptions) {
+	buf.WriteString("#EXTM3U\n")
+	if ver := writeVersion(buf, opts, p.ver, p.RequiredVersion()); ver >= 6 && !opts.OmitDeprecated {
+		// PROGRAM-ID is removed since protocol version 6, section 7
+		omit := *opts
+		omit.OmitDeprecated = true
+		opts = &omit
+	}
 
 	if p.IndependentSegments() {
-		p.buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+		buf.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
 	}
 
 	// Write any custom master tags
-	if p.Custom != nil {
-		for _, v := range p.Custom {
-			if customBuf := v.Encode(); customBuf != nil {
-				p.buf.WriteString(customBuf.String())
-				p.buf.WriteRune('\n')
-			}
-		}
-	}
+	writeCustomTags(buf, p.Custom, p.customOrder)
 
 	altsWritten := make(map[string]bool)
 
 	for _, pl := range p.Variants {
+		if buf.done() {
+			return
+		}
 		if pl.Alternatives != nil {
 			for _, alt := range pl.Alternatives {
 				// Make sure that we only write out an alternative once
@@ -105,181 +449,260 @@ func (p *MasterPlaylist) Encode() *bytes.Buffer {
 				}
 				altsWritten[altKey] = true
 
-				p.buf.WriteString("#EXT-X-MEDIA:")
-				if alt.Type != "" {
-					p.buf.WriteString("TYPE=") // Type should not be quoted
-					p.buf.WriteString(alt.Type)
-				}
-				if alt.GroupId != "" {
-					p.buf.WriteString(",GROUP-ID=\"")
-					p.buf.WriteString(alt.GroupId)
-					p.buf.WriteRune('"')
-				}
-				if alt.Name != "" {
-					p.buf.WriteString(",NAME=\"")
-					p.buf.WriteString(alt.Name)
-					p.buf.WriteRune('"')
-				}
-				p.buf.WriteString(",DEFAULT=")
-				if alt.Default {
-					p.buf.WriteString("YES")
-				} else {
-					p.buf.WriteString("NO")
-				}
-				if alt.Autoselect != "" {
-					p.buf.WriteString(",AUTOSELECT=")
-					p.buf.WriteString(alt.Autoselect)
-				}
-				if alt.Language != "" {
-					p.buf.WriteString(",LANGUAGE=\"")
-					p.buf.WriteString(alt.Language)
-					p.buf.WriteRune('"')
-				}
-				if alt.Forced != "" {
-					p.buf.WriteString(",FORCED=\"")
-					p.buf.WriteString(alt.Forced)
-					p.buf.WriteRune('"')
-				}
-				if alt.Characteristics != "" {
-					p.buf.WriteString(",CHARACTERISTICS=\"")
-					p.buf.WriteString(alt.Characteristics)
-					p.buf.WriteRune('"')
-				}
-				if alt.Subtitles != "" {
-					p.buf.WriteString(",SUBTITLES=\"")
-					p.buf.WriteString(alt.Subtitles)
-					p.buf.WriteRune('"')
-				}
-				if alt.URI != "" {
-					p.buf.WriteString(",URI=\"")
-					p.buf.WriteString(alt.URI)
-					p.buf.WriteRune('"')
-				}
-				p.buf.WriteRune('\n')
+				writeCustomTags(buf, alt.Custom, alt.customOrder)
+				writeAlternative(buf, alt)
 			}
 		}
+		writeCustomTags(buf, pl.Custom, pl.customOrder)
 		if pl.Iframe {
-			p.buf.WriteString("#EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.ProgramId), 10))
-			p.buf.WriteString(",BANDWIDTH=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.Bandwidth), 10))
-			if pl.AverageBandwidth != 0 {
-				p.buf.WriteString(",AVERAGE-BANDWIDTH=")
-				p.buf.WriteString(strconv.FormatUint(uint64(pl.AverageBandwidth), 10))
-			}
-			if pl.Codecs != "" {
-				p.buf.WriteString(",CODECS=\"")
-				p.buf.WriteString(pl.Codecs)
-				p.buf.WriteRune('"')
-			}
-			if pl.Resolution != "" {
-				p.buf.WriteString(",RESOLUTION=") // Resolution should not be quoted
-				p.buf.WriteString(pl.Resolution)
-			}
-			if pl.Video != "" {
-				p.buf.WriteString(",VIDEO=\"")
-				p.buf.WriteString(pl.Video)
-				p.buf.WriteRune('"')
-			}
-			if pl.VideoRange != "" {
-				p.buf.WriteString(",VIDEO-RANGE=")
-				p.buf.WriteString(pl.VideoRange)
-			}
-			if pl.HDCPLevel != "" {
-				p.buf.WriteString(",HDCP-LEVEL=")
-				p.buf.WriteString(pl.HDCPLevel)
-			}
-			if pl.URI != "" {
-				p.buf.WriteString(",URI=\"")
-				p.buf.WriteString(pl.URI)
-				p.buf.WriteRune('"')
-			}
-			p.buf.WriteRune('\n')
+			writeIframeStreamInf(buf, pl, opts)
 		} else {
-			p.buf.WriteString("#EXT-X-STREAM-INF:PROGRAM-ID=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.ProgramId), 10))
-			p.buf.WriteString(",BANDWIDTH=")
-			p.buf.WriteString(strconv.FormatUint(uint64(pl.Bandwidth), 10))
-			if pl.AverageBandwidth != 0 {
-				p.buf.WriteString(",AVERAGE-BANDWIDTH=")
-				p.buf.WriteString(strconv.FormatUint(uint64(pl.AverageBandwidth), 10))
-			}
-			if pl.Codecs != "" {
-				p.buf.WriteString(",CODECS=\"")
-				p.buf.WriteString(pl.Codecs)
-				p.buf.WriteRune('"')
-			}
-			if pl.Resolution != "" {
-				p.buf.WriteString(",RESOLUTION=") // Resolution should not be quoted
-				p.buf.WriteString(pl.Resolution)
-			}
-			if pl.Audio != "" {
-				p.buf.WriteString(",AUDIO=\"")
-				p.buf.WriteString(pl.Audio)
-				p.buf.WriteRune('"')
-			}
-			if pl.Video != "" {
-				p.buf.WriteString(",VIDEO=\"")
-				p.buf.WriteString(pl.Video)
-				p.buf.WriteRune('"')
-			}
-			if pl.Captions != "" {
-				p.buf.WriteString(",CLOSED-CAPTIONS=")
-				if pl.Captions == "NONE" {
-					p.buf.WriteString(pl.Captions) // CC should not be quoted when eq NONE
-				} else {
-					p.buf.WriteRune('"')
-					p.buf.WriteString(pl.Captions)
-					p.buf.WriteRune('"')
-				}
-			}
-			if pl.Subtitles != "" {
-				p.buf.WriteString(",SUBTITLES=\"")
-				p.buf.WriteString(pl.Subtitles)
-				p.buf.WriteRune('"')
-			}
-			if pl.Name != "" {
-				p.buf.WriteString(",NAME=\"")
-				p.buf.WriteString(pl.Name)
-				p.buf.WriteRune('"')
-			}
-			if pl.FrameRate != 0 {
-				p.buf.WriteString(",FRAME-RATE=")
-				p.buf.WriteString(strconv.FormatFloat(pl.FrameRate, 'f', 3, 64))
-			}
-			if pl.VideoRange != "" {
-				p.buf.WriteString(",VIDEO-RANGE=")
-				p.buf.WriteString(pl.VideoRange)
-			}
-			if pl.HDCPLevel != "" {
-				p.buf.WriteString(",HDCP-LEVEL=")
-				p.buf.WriteString(pl.HDCPLevel)
-			}
-
-			p.buf.WriteRune('\n')
-			p.buf.WriteString(pl.URI)
+			writeStreamInf(buf, pl, opts)
+			buf.checkURI("#EXT-X-STREAM-INF", pl.URI)
+			buf.checkText("#EXT-X-STREAM-INF", "URI arguments", p.Args)
+			buf.WriteString(pl.URI)
 			if p.Args != "" {
 				if strings.Contains(pl.URI, "?") {
-					p.buf.WriteRune('&')
+					buf.WriteRune('&')
 				} else {
-					p.buf.WriteRune('?')
+					buf.WriteRune('?')
 				}
-				p.buf.WriteString(p.Args)
+				buf.WriteString(p.Args)
 			}
-			p.buf.WriteRune('\n')
+			buf.WriteRune('\n')
 		}
 	}
+}
 
-	return &p.buf
+// writeAlternative writes EXT-X-MEDIA tag of the rendition.
+func writeAlternative(buf *encodeWriter, alt *Alternative) {
+	buf.WriteString("#EXT-X-MEDIA:")
+	w := buf.attributes()
+	if buf.strict {
+		switch {
+		case alt.Type != "AUDIO" && alt.Type != "VIDEO" && alt.Type != "SUBTITLES" && alt.Type != "CLOSED-CAPTIONS":
+			buf.invalid("#EXT-X-MEDIA", invalidAttribute("TYPE", alt.Type, nil))
+		case alt.GroupId == "":
+			buf.invalid("#EXT-X-MEDIA", &AttributeError{"GROUP-ID", ErrNoAttribute})
+		case alt.Name == "":
+			buf.invalid("#EXT-X-MEDIA", &AttributeError{"NAME", ErrNoAttribute})
+		}
+	}
+	if alt.Type != "" {
+		w.Enum("TYPE", alt.Type)
+	}
+	if alt.GroupId != "" {
+		w.QuotedString("GROUP-ID", alt.GroupId)
+	}
+	if alt.Name != "" {
+		w.QuotedString("NAME", alt.Name)
+	}
+	w.Bool("DEFAULT", alt.Default)
+	if alt.Autoselect != "" {
+		w.Enum("AUTOSELECT", alt.Autoselect)
+	}
+	if alt.Language != "" {
+		w.QuotedString("LANGUAGE", alt.Language)
+	}
+	if alt.Forced != "" {
+		w.QuotedString("FORCED", alt.Forced)
+	}
+	if alt.Characteristics != "" {
+		w.QuotedString("CHARACTERISTICS", alt.Characteristics)
+	}
+	if alt.Subtitles != "" {
+		w.QuotedString("SUBTITLES", alt.Subtitles)
+	}
+	if alt.URI != "" {
+		w.QuotedString("URI", alt.URI)
+	}
+	buf.endTag("#EXT-X-MEDIA", w)
 }
 
-// SetCustomTag sets the provided tag on the master playlist for its TagName
-func (p *MasterPlaylist) SetCustomTag(tag CustomTag) {
-	if p.Custom == nil {
-		p.Custom = make(map[string]CustomTag)
+// writeIframeStreamInf writes EXT-X-I-FRAME-STREAM-INF tag of the variant.
+func writeIframeStreamInf(buf *encodeWriter, pl *Variant, opts *EncoderOptions) {
+	buf.WriteString("#EXT-X-I-FRAME-STREAM-INF:")
+	w := buf.attributes()
+	if !opts.OmitDeprecated {
+		w.Uint("PROGRAM-ID", uint64(pl.ProgramId))
+	}
+	w.Uint("BANDWIDTH", uint64(pl.Bandwidth))
+	if pl.AverageBandwidth != 0 {
+		w.Uint("AVERAGE-BANDWIDTH", uint64(pl.AverageBandwidth))
 	}
+	if pl.Codecs != "" {
+		w.QuotedString("CODECS", pl.Codecs)
+	}
+	if pl.Resolution != "" {
+		if _, _, err := (Attribute{Name: "RESOLUTION", Value: pl.Resolution}).Resolution(); err != nil {
+			buf.invalid("#EXT-X-I-FRAME-STREAM-INF", err)
+		}
+		w.Enum("RESOLUTION", pl.Resolution) // Resolution should not be quoted
+	}
+	if pl.Video != "" {
+		w.QuotedString("VIDEO", pl.Video)
+	}
+	if pl.VideoRange != "" {
+		w.Enum("VIDEO-RANGE", pl.VideoRange)
+	}
+	if pl.HDCPLevel != "" {
+		w.Enum("HDCP-LEVEL", pl.HDCPLevel)
+	}
+	if pl.StableVariantId != "" {
+		w.QuotedString("STABLE-VARIANT-ID", pl.StableVariantId)
+	}
+	buf.checkURI("#EXT-X-I-FRAME-STREAM-INF", pl.URI)
+	if pl.URI != "" {
+		w.QuotedString("URI", pl.URI)
+	}
+	buf.endTag("#EXT-X-I-FRAME-STREAM-INF", w)
+}
+
+// writeStreamInf writes EXT-X-STREAM-INF tag of the variant, the URI
+// line is written by the caller.
+func writeStreamInf(buf *encodeWriter, pl *Variant, opts *EncoderOptions) {
+	buf.WriteString("#EXT-X-STREAM-INF:")
+	w := buf.attributes()
+	if !opts.OmitDeprecated {
+		w.Uint("PROGRAM-ID", uint64(pl.ProgramId))
+	}
+	w.Uint("BANDWIDTH", uint64(pl.Bandwidth))
+	if pl.AverageBandwidth != 0 {
+		w.Uint("AVERAGE-BANDWIDTH", uint64(pl.AverageBandwidth))
+	}
+	if pl.Codecs != "" {
+		w.QuotedString("CODECS", pl.Codecs)
+	}
+	if pl.Resolution != "" {
+		if _, _, err := (Attribute{Name: "RESOLUTION", Value: pl.Resolution}).Resolution(); err != nil {
+			buf.invalid("#EXT-X-STREAM-INF", err)
+		}
+		w.Enum("RESOLUTION", pl.Resolution) // Resolution should not be quoted
+	}
+	if pl.Audio != "" {
+		w.QuotedString("AUDIO", pl.Audio)
+	}
+	if pl.Video != "" {
+		w.QuotedString("VIDEO", pl.Video)
+	}
+	if pl.Captions == "NONE" {
+		w.Enum("CLOSED-CAPTIONS", pl.Captions) // CC should not be quoted when eq NONE
+	} else if pl.Captions != "" {
+		w.QuotedString("CLOSED-CAPTIONS", pl.Captions)
+	}
+	if pl.Subtitles != "" {
+		w.QuotedString("SUBTITLES", pl.Subtitles)
+	}
+	if pl.Name != "" {
+		w.QuotedString("NAME", pl.Name)
+	}
+	if pl.FrameRate != 0 {
+		w.Float("FRAME-RATE", pl.FrameRate, 3)
+	}
+	if pl.VideoRange != "" {
+		w.Enum("VIDEO-RANGE", pl.VideoRange)
+	}
+	if pl.HDCPLevel != "" {
+		w.Enum("HDCP-LEVEL", pl.HDCPLevel)
+	}
+	if pl.StableVariantId != "" {
+		w.QuotedString("STABLE-VARIANT-ID", pl.StableVariantId)
+	}
+	buf.endTag("#EXT-X-STREAM-INF", w)
+}
+
+// writeKey writes EXT-X-KEY tag.
+func writeKey(buf *encodeWriter, key *Key) {
+	buf.WriteString("#EXT-X-KEY:")
+	w := buf.attributes()
+	w.Enum("METHOD", key.Method)
+	if key.Method != "NONE" {
+		buf.checkURI("#EXT-X-KEY", key.URI)
+		w.QuotedString("URI", key.URI)
+		if key.IV != "" {
+			if !isHexadecimalSequence(key.IV) {
+				buf.invalid("#EXT-X-KEY", invalidAttribute("IV", key.IV, errors.New("not a hexadecimal-sequence")))
+			}
+			w.Enum("IV", key.IV)
+		}
+		if key.Keyformat != "" {
+			w.QuotedString("KEYFORMAT", key.Keyformat)
+		}
+		if key.Keyformatversions != "" {
+			w.QuotedString("KEYFORMATVERSIONS", key.Keyformatversions)
+		}
+	}
+	buf.endTag("#EXT-X-KEY", w)
+}
+
+// isHexadecimalSequence checks the value is 0x or 0X followed by hex
+// digits.
+func isHexadecimalSequence(value string) bool {
+	if len(value) < 3 || value[0] != '0' || (value[1] != 'x' && value[1] != 'X') {
+		return false
+	}
+	for _, c := range value[2:] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeMap writes EXT-X-MAP tag.
+func writeMap(buf *encodeWriter, m *Map) {
+	buf.WriteString("#EXT-X-MAP:")
+	w := buf.attributes()
+	buf.checkURI("#EXT-X-MAP", m.URI)
+	w.QuotedString("URI", m.URI)
+	if m.Limit < 0 || m.Offset < 0 {
+		buf.invalid("#EXT-X-MAP", invalidAttribute("BYTERANGE", strconv.FormatInt(m.Limit, 10)+"@"+strconv.FormatInt(m.Offset, 10), errors.New("negative byte range")))
+	}
+	if m.Limit > 0 {
+		w.Raw("BYTERANGE", strconv.FormatInt(m.Limit, 10)+"@"+strconv.FormatInt(m.Offset, 10))
+	}
+	buf.endTag("#EXT-X-MAP", w)
+}
+
+// SetCustomTag sets the provided tag on the master playlist for its
+// TagName. It replaces all the tags with the same name.
+func (p *MasterPlaylist) SetCustomTag(tag CustomTag) {
+	setCustomTag(&p.Custom, &p.customOrder, tag.TagName(), tag)
+}
 
-	p.Custom[tag.TagName()] = tag
+// AddCustomTag adds the provided tag to the master playlist. Unlike
+// SetCustomTag it keeps the tags with the same name so the tag may
+// repeat.
+func (p *MasterPlaylist) AddCustomTag(tag CustomTag) {
+	addCustomTag(&p.Custom, &p.customOrder, tag.TagName(), tag)
+}
+
+// SetCustomTag sets the provided tag on the variant for its TagName.
+// The tag is encoded before EXT-X-STREAM-INF or EXT-X-I-FRAME-STREAM-INF
+// of the variant. It replaces all the tags with the same name.
+func (v *Variant) SetCustomTag(tag CustomTag) {
+	setCustomTag(&v.Custom, &v.customOrder, tag.TagName(), tag)
+}
+
+// AddCustomTag adds the provided tag to the variant. Unlike
+// SetCustomTag it keeps the tags with the same name so the tag may
+// repeat.
+func (v *Variant) AddCustomTag(tag CustomTag) {
+	addCustomTag(&v.Custom, &v.customOrder, tag.TagName(), tag)
+}
+
+// SetCustomTag sets the provided tag on the rendition for its TagName.
+// The tag is encoded before EXT-X-MEDIA of the rendition. It replaces
+// all the tags with the same name.
+func (a *Alternative) SetCustomTag(tag CustomTag) {
+	setCustomTag(&a.Custom, &a.customOrder, tag.TagName(), tag)
+}
+
+// AddCustomTag adds the provided tag to the rendition. Unlike
+// SetCustomTag it keeps the tags with the same name so the tag may
+// repeat.
+func (a *Alternative) AddCustomTag(tag CustomTag) {
+	addCustomTag(&a.Custom, &a.customOrder, tag.TagName(), tag)
 }
 
 // Version returns the current playlist version number
@@ -334,6 +757,23 @@ func (p *MediaPlaylist) last() uint {
 	return p.tail - 1
 }
 
+// grow extends the ring buffer to hold at least n more segments. The
+// segments are moved to the new buffer in their order from the head.
+func (p *MediaPlaylist) grow(n uint) {
+	if p.capacity-p.count >= n {
+		return
+	}
+	segments := make([]*MediaSegment, p.count+n)
+	if p.head < p.tail || p.count == 0 {
+		copy(segments, p.Segments[p.head:p.tail])
+	} else {
+		copied := copy(segments, p.Segments[p.head:p.capacity])
+		copy(segments[copied:], p.Segments[:p.tail])
+	}
+	p.Segments, p.capacity = segments, uint(len(segments))
+	p.head, p.tail = 0, p.count
+}
+
 // Remove current segment from the head of chunk slice form a media playlist. Useful for sliding playlists.
 // This operation does reset playlist cache.
 func (p *MediaPlaylist) Remove() (err error) {
@@ -402,158 +842,173 @@ func (p *MediaPlaylist) Encode() *bytes.Buffer {
 	if p.buf.Len() > 0 {
 		return &p.buf
 	}
+	p.encode(newEncodeWriter(context.Background(), &p.buf, &p.encoder), &p.encoder)
+	return &p.buf
+}
+
+// EncodeWithOptions generates output in M3U8 format with the
+// options. Unlike Encode it doesn't use and doesn't fill the cache.
+func (p *MediaPlaylist) EncodeWithOptions(opts EncoderOptions) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	p.encode(newEncodeWriter(context.Background(), buf, &opts), &opts)
+	return buf
+}
 
-	p.buf.WriteString("#EXTM3U\n#EXT-X-VERSION:")
-	p.buf.WriteString(strver(p.ver))
-	p.buf.WriteRune('\n')
+// EncodeStrict generates output in M3U8 format like Encode but checks
+// the values against the playlist syntax of RFC 8216 as it writes
+// them. It returns EncodeError for the first value which would break
+// the playlist, for example a segment URI with line break, a key
+// without URI or a negative byte range, and no output at all. The
+// cache is not used.
+func (p *MediaPlaylist) EncodeStrict() (*bytes.Buffer, error) {
+	opts := p.encoder
+	return encodeStrict(&opts, func(ew *encodeWriter) { p.encode(ew, &opts) })
+}
 
-	// Write any custom master tags
-	if p.Custom != nil {
-		for _, v := range p.Custom {
-			if customBuf := v.Encode(); customBuf != nil {
-				p.buf.WriteString(customBuf.String())
-				p.buf.WriteRune('\n')
-			}
-		}
+// WriteTo writes the playlist in M3U8 format to the writer. Unlike
+// Encode it streams the output segment by segment without building it
+// in memory and doesn't use the cache. It returns the number of bytes
+// written and the first write error.
+func (p *MediaPlaylist) WriteTo(w io.Writer) (int64, error) {
+	return p.WriteToContext(context.Background(), w)
+}
+
+// WriteToContext works like WriteTo but stops writing with the
+// context error as soon as the context is done, for example when the
+// HTTP client disconnects.
+func (p *MediaPlaylist) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	opts := p.encoder
+	return writeTo(ctx, w, &opts, func(ew *encodeWriter) { p.encode(ew, &opts) })
+}
+
+// SetEncoderOptions sets the options used by Encode. This operation
+// does reset playlist cache.
+func (p *MediaPlaylist) SetEncoderOptions(opts EncoderOptions) {
+	if opts.DurationAsInt {
+		// duration must be integers if protocol version is less than 3
+		version(&p.ver, 3)
 	}
+	p.encoder = opts
+	p.buf.Reset()
+}
+
+func (p *MediaPlaylist) encode(buf *encodeWriter, opts *EncoderOptions) {
+	buf.WriteString("#EXTM3U\n")
+	writeVersion(buf, opts, p.ver, p.requiredVersion(opts))
+
+	// Write any custom master tags
+	writeCustomTags(buf, p.Custom, p.customOrder)
 
 	// default key (workaround for Widevine)
 	if p.Key != nil {
-		p.buf.WriteString("#EXT-X-KEY:")
-		p.buf.WriteString("METHOD=")
-		p.buf.WriteString(p.Key.Method)
-		if p.Key.Method != "NONE" {
-			p.buf.WriteString(",URI=\"")
-			p.buf.WriteString(p.Key.URI)
-			p.buf.WriteRune('"')
-			if p.Key.IV != "" {
-				p.buf.WriteString(",IV=")
-				p.buf.WriteString(p.Key.IV)
-			}
-			if p.Key.Keyformat != "" {
-				p.buf.WriteString(",KEYFORMAT=\"")
-				p.buf.WriteString(p.Key.Keyformat)
-				p.buf.WriteRune('"')
-			}
-			if p.Key.Keyformatversions != "" {
-				p.buf.WriteString(",KEYFORMATVERSIONS=\"")
-				p.buf.WriteString(p.Key.Keyformatversions)
-				p.buf.WriteRune('"')
-			}
-		}
-		p.buf.WriteRune('\n')
+		writeKey(buf, p.Key)
 	}
 	if p.Map != nil {
-		p.buf.WriteString("#EXT-X-MAP:")
-		p.buf.WriteString("URI=\"")
-		p.buf.WriteString(p.Map.URI)
-		p.buf.WriteRune('"')
-		if p.Map.Limit > 0 {
-			p.buf.WriteString(",BYTERANGE=")
-			p.buf.WriteString(strconv.FormatInt(p.Map.Limit, 10))
-			p.buf.WriteRune('@')
-			p.buf.WriteString(strconv.FormatInt(p.Map.Offset, 10))
-		}
-		p.buf.WriteRune('\n')
+		writeMap(buf, p.Map)
 	}
 	if p.MediaType > 0 {
-		p.buf.WriteString("#EXT-X-PLAYLIST-TYPE:")
+		buf.WriteString("#EXT-X-PLAYLIST-TYPE:")
 		switch p.MediaType {
 		case EVENT:
-			p.buf.WriteString("EVENT\n")
-			p.buf.WriteString("#EXT-X-ALLOW-CACHE:NO\n")
+			buf.WriteString("EVENT\n")
+			buf.WriteString("#EXT-X-ALLOW-CACHE:NO\n")
 		case VOD:
-			p.buf.WriteString("VOD\n")
+			buf.WriteString("VOD\n")
 		}
 	}
-	p.buf.WriteString("#EXT-X-MEDIA-SEQUENCE:")
-	p.buf.WriteString(strconv.FormatUint(p.SeqNo, 10))
-	p.buf.WriteRune('\n')
-	p.buf.WriteString("#EXT-X-TARGETDURATION:")
-	p.buf.WriteString(strconv.FormatInt(int64(math.Ceil(p.TargetDuration)), 10)) // due section 3.4.2 of M3U8 specs EXT-X-TARGETDURATION must be integer
-	p.buf.WriteRune('\n')
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:")
+	buf.WriteString(strconv.FormatUint(p.SeqNo, 10))
+	buf.WriteRune('\n')
+	buf.WriteString("#EXT-X-TARGETDURATION:")
+	buf.WriteString(strconv.FormatInt(int64(math.Ceil(p.TargetDuration)), 10)) // due section 3.4.2 of M3U8 specs EXT-X-TARGETDURATION must be integer
+	buf.WriteRune('\n')
 	if p.StartTime > 0.0 {
-		p.buf.WriteString("#EXT-X-START:TIME-OFFSET=")
-		p.buf.WriteString(strconv.FormatFloat(p.StartTime, 'f', -1, 64))
+		buf.WriteString("#EXT-X-START:")
+		w := buf.attributes()
+		w.Float("TIME-OFFSET", p.StartTime, -1)
 		if p.StartTimePrecise {
-			p.buf.WriteString(",PRECISE=YES")
+			w.Bool("PRECISE", true)
 		}
-		p.buf.WriteRune('\n')
+		buf.endTag("#EXT-X-START", w)
 	}
 	if p.DiscontinuitySeq != 0 {
-		p.buf.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:")
-		p.buf.WriteString(strconv.FormatUint(uint64(p.DiscontinuitySeq), 10))
-		p.buf.WriteRune('\n')
+		buf.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:")
+		buf.WriteString(strconv.FormatUint(uint64(p.DiscontinuitySeq), 10))
+		buf.WriteRune('\n')
 	}
 	if p.Iframe {
-		p.buf.WriteString("#EXT-X-I-FRAMES-ONLY\n")
+		buf.WriteString("#EXT-X-I-FRAMES-ONLY\n")
 	}
 	// Widevine tags
 	if p.WV != nil {
+		buf.checkText("#WV-CYPHER-VERSION", "value", p.WV.CypherVersion)
+		buf.checkText("#WV-ECM", "value", p.WV.ECM)
+		buf.checkText("#WV-VIDEO-RESOLUTION", "value", p.WV.VideoResolution)
+		buf.checkText("#WV-VIDEO-SAR", "value", p.WV.VideoSAR)
 		if p.WV.AudioChannels != 0 {
-			p.buf.WriteString("#WV-AUDIO-CHANNELS ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioChannels), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-AUDIO-CHANNELS ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioChannels), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.AudioFormat != 0 {
-			p.buf.WriteString("#WV-AUDIO-FORMAT ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioFormat), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-AUDIO-FORMAT ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioFormat), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.AudioProfileIDC != 0 {
-			p.buf.WriteString("#WV-AUDIO-PROFILE-IDC ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioProfileIDC), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-AUDIO-PROFILE-IDC ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioProfileIDC), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.AudioSampleSize != 0 {
-			p.buf.WriteString("#WV-AUDIO-SAMPLE-SIZE ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSampleSize), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-AUDIO-SAMPLE-SIZE ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSampleSize), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.AudioSamplingFrequency != 0 {
-			p.buf.WriteString("#WV-AUDIO-SAMPLING-FREQUENCY ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSamplingFrequency), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-AUDIO-SAMPLING-FREQUENCY ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.AudioSamplingFrequency), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.CypherVersion != "" {
-			p.buf.WriteString("#WV-CYPHER-VERSION ")
-			p.buf.WriteString(p.WV.CypherVersion)
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-CYPHER-VERSION ")
+			buf.WriteString(p.WV.CypherVersion)
+			buf.WriteRune('\n')
 		}
 		if p.WV.ECM != "" {
-			p.buf.WriteString("#WV-ECM ")
-			p.buf.WriteString(p.WV.ECM)
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-ECM ")
+			buf.WriteString(p.WV.ECM)
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoFormat != 0 {
-			p.buf.WriteString("#WV-VIDEO-FORMAT ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFormat), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-FORMAT ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFormat), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoFrameRate != 0 {
-			p.buf.WriteString("#WV-VIDEO-FRAME-RATE ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFrameRate), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-FRAME-RATE ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoFrameRate), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoLevelIDC != 0 {
-			p.buf.WriteString("#WV-VIDEO-LEVEL-IDC")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoLevelIDC), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-LEVEL-IDC ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoLevelIDC), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoProfileIDC != 0 {
-			p.buf.WriteString("#WV-VIDEO-PROFILE-IDC ")
-			p.buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoProfileIDC), 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-PROFILE-IDC ")
+			buf.WriteString(strconv.FormatUint(uint64(p.WV.VideoProfileIDC), 10))
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoResolution != "" {
-			p.buf.WriteString("#WV-VIDEO-RESOLUTION ")
-			p.buf.WriteString(p.WV.VideoResolution)
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-RESOLUTION ")
+			buf.WriteString(p.WV.VideoResolution)
+			buf.WriteRune('\n')
 		}
 		if p.WV.VideoSAR != "" {
-			p.buf.WriteString("#WV-VIDEO-SAR ")
-			p.buf.WriteString(p.WV.VideoSAR)
-			p.buf.WriteRune('\n')
+			buf.WriteString("#WV-VIDEO-SAR ")
+			buf.WriteString(p.WV.VideoSAR)
+			buf.WriteRune('\n')
 		}
 	}
 
@@ -565,6 +1020,9 @@ func (p *MediaPlaylist) Encode() *bytes.Buffer {
 	head := p.head
 	count := p.count
 	for i := uint(0); (i < p.winsize || p.winsize == 0) && count > 0; count-- {
+		if buf.done() {
+			return
+		}
 		seg = p.Segments[head]
 		head = (head + 1) % p.capacity
 		if seg == nil { // protection from badly filled chunklists
@@ -576,144 +1034,103 @@ func (p *MediaPlaylist) Encode() *bytes.Buffer {
 		if seg.SCTE != nil {
 			switch seg.SCTE.Syntax {
 			case SCTE35_67_2014:
-				p.buf.WriteString("#EXT-SCTE35:")
-				p.buf.WriteString("CUE=\"")
-				p.buf.WriteString(seg.SCTE.Cue)
-				p.buf.WriteRune('"')
+				buf.WriteString("#EXT-SCTE35:")
+				w := buf.attributes()
+				w.QuotedString("CUE", seg.SCTE.Cue)
 				if seg.SCTE.ID != "" {
-					p.buf.WriteString(",ID=\"")
-					p.buf.WriteString(seg.SCTE.ID)
-					p.buf.WriteRune('"')
+					w.QuotedString("ID", seg.SCTE.ID)
 				}
 				if seg.SCTE.Time != 0 {
-					p.buf.WriteString(",TIME=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
+					w.Float("TIME", seg.SCTE.Time, -1)
 				}
-				p.buf.WriteRune('\n')
+				buf.endTag("#EXT-SCTE35", w)
 			case SCTE35_OATCLS:
 				switch seg.SCTE.CueType {
 				case SCTE35Cue_Start:
 					if seg.SCTE.Cue != "" {
-						p.buf.WriteString("#EXT-OATCLS-SCTE35:")
-						p.buf.WriteString(seg.SCTE.Cue)
-						p.buf.WriteRune('\n')
+						buf.checkText("#EXT-OATCLS-SCTE35", "cue", seg.SCTE.Cue)
+						buf.WriteString("#EXT-OATCLS-SCTE35:")
+						buf.WriteString(seg.SCTE.Cue)
+						buf.WriteRune('\n')
 					}
-					p.buf.WriteString("#EXT-X-CUE-OUT:")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
-					p.buf.WriteRune('\n')
+					buf.WriteString("#EXT-X-CUE-OUT:")
+					buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
+					buf.WriteRune('\n')
 				case SCTE35Cue_Mid:
-					p.buf.WriteString("#EXT-X-CUE-OUT-CONT:")
-					p.buf.WriteString("ElapsedTime=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Elapsed, 'f', -1, 64))
-					p.buf.WriteString(",Duration=")
-					p.buf.WriteString(strconv.FormatFloat(seg.SCTE.Time, 'f', -1, 64))
-					p.buf.WriteString(",SCTE35=")
-					p.buf.WriteString(seg.SCTE.Cue)
-					p.buf.WriteRune('\n')
+					buf.WriteString("#EXT-X-CUE-OUT-CONT:")
+					w := buf.attributes()
+					w.Float("ElapsedTime", seg.SCTE.Elapsed, -1)
+					w.Float("Duration", seg.SCTE.Time, -1)
+					buf.checkText("#EXT-X-CUE-OUT-CONT", "cue", seg.SCTE.Cue)
+					w.Raw("SCTE35", seg.SCTE.Cue)
+					buf.endTag("#EXT-X-CUE-OUT-CONT", w)
 				case SCTE35Cue_End:
-					p.buf.WriteString("#EXT-X-CUE-IN")
-					p.buf.WriteRune('\n')
+					buf.WriteString("#EXT-X-CUE-IN")
+					buf.WriteRune('\n')
 				}
 			}
 		}
 		// check for key change
 		if seg.Key != nil && p.Key != seg.Key {
-			p.buf.WriteString("#EXT-X-KEY:")
-			p.buf.WriteString("METHOD=")
-			p.buf.WriteString(seg.Key.Method)
-			if seg.Key.Method != "NONE" {
-				p.buf.WriteString(",URI=\"")
-				p.buf.WriteString(seg.Key.URI)
-				p.buf.WriteRune('"')
-				if seg.Key.IV != "" {
-					p.buf.WriteString(",IV=")
-					p.buf.WriteString(seg.Key.IV)
-				}
-				if seg.Key.Keyformat != "" {
-					p.buf.WriteString(",KEYFORMAT=\"")
-					p.buf.WriteString(seg.Key.Keyformat)
-					p.buf.WriteRune('"')
-				}
-				if seg.Key.Keyformatversions != "" {
-					p.buf.WriteString(",KEYFORMATVERSIONS=\"")
-					p.buf.WriteString(seg.Key.Keyformatversions)
-					p.buf.WriteRune('"')
-				}
-			}
-			p.buf.WriteRune('\n')
+			writeKey(buf, seg.Key)
 		}
 		if seg.Discontinuity != nil {
-			p.buf.WriteString("#EXT-X-DISCONTINUITY")
+			buf.WriteString("#EXT-X-DISCONTINUITY")
 			if *seg.Discontinuity != 0 {
-				p.buf.WriteString(":")
-				p.buf.WriteString(strconv.FormatFloat(*seg.Discontinuity, 'f', 6, 64))
+				buf.WriteString(":")
+				buf.WriteString(strconv.FormatFloat(*seg.Discontinuity, 'f', 6, 64))
 			}
-			p.buf.WriteRune('\n')
+			buf.WriteRune('\n')
 		}
 		// ignore segment Map if default playlist Map is present
 		if p.Map == nil && seg.Map != nil {
-			p.buf.WriteString("#EXT-X-MAP:")
-			p.buf.WriteString("URI=\"")
-			p.buf.WriteString(seg.Map.URI)
-			p.buf.WriteRune('"')
-			if seg.Map.Limit > 0 {
-				p.buf.WriteString(",BYTERANGE=")
-				p.buf.WriteString(strconv.FormatInt(seg.Map.Limit, 10))
-				p.buf.WriteRune('@')
-				p.buf.WriteString(strconv.FormatInt(seg.Map.Offset, 10))
-			}
-			p.buf.WriteRune('\n')
+			writeMap(buf, seg.Map)
 		}
 		if !seg.ProgramDateTime.IsZero() {
-			p.buf.WriteString("#EXT-X-PROGRAM-DATE-TIME:")
-			p.buf.WriteString(seg.ProgramDateTime.Format(DATETIME))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#EXT-X-PROGRAM-DATE-TIME:")
+			buf.WriteString(opts.formatTime(seg.ProgramDateTime))
+			buf.WriteRune('\n')
+		}
+		if seg.Limit < 0 || seg.Offset < 0 {
+			buf.invalid("#EXT-X-BYTERANGE", fmt.Errorf("negative byte range %d@%d", seg.Limit, seg.Offset))
 		}
 		if seg.Limit > 0 {
-			p.buf.WriteString("#EXT-X-BYTERANGE:")
-			p.buf.WriteString(strconv.FormatInt(seg.Limit, 10))
-			p.buf.WriteRune('@')
-			p.buf.WriteString(strconv.FormatInt(seg.Offset, 10))
-			p.buf.WriteRune('\n')
+			buf.WriteString("#EXT-X-BYTERANGE:")
+			buf.WriteString(strconv.FormatInt(seg.Limit, 10))
+			buf.WriteRune('@')
+			buf.WriteString(strconv.FormatInt(seg.Offset, 10))
+			buf.WriteRune('\n')
 		}
 
 		// Add Custom Segment Tags here
-		if seg.Custom != nil {
-			for _, v := range seg.Custom {
-				if customBuf := v.Encode(); customBuf != nil {
-					p.buf.WriteString(customBuf.String())
-					p.buf.WriteRune('\n')
-				}
-			}
-		}
+		writeCustomTags(buf, seg.Custom, seg.customOrder)
 
-		p.buf.WriteString("#EXTINF:")
-		if str, ok := durationCache[seg.Duration]; ok {
-			p.buf.WriteString(str)
-		} else {
-			if p.durationAsInt {
-				// Old Android players has problems with non integer Duration.
-				durationCache[seg.Duration] = strconv.FormatInt(int64(math.Ceil(seg.Duration)), 10)
-			} else {
-				// Wowza Mediaserver and some others prefer floats.
-				durationCache[seg.Duration] = strconv.FormatFloat(seg.Duration, 'f', 3, 32)
-			}
-			p.buf.WriteString(durationCache[seg.Duration])
+		if buf.strict && (seg.Duration < 0 || math.IsNaN(seg.Duration) || math.IsInf(seg.Duration, 0)) {
+			buf.invalid("#EXTINF", fmt.Errorf("invalid duration %v", seg.Duration))
 		}
-		p.buf.WriteRune(',')
-		p.buf.WriteString(seg.Title)
-		p.buf.WriteRune('\n')
-		p.buf.WriteString(seg.URI)
+		buf.checkText("#EXTINF", "title", seg.Title)
+		buf.checkURI("#EXTINF", seg.URI)
+		buf.checkText("#EXTINF", "URI arguments", p.Args)
+		buf.WriteString("#EXTINF:")
+		str, ok := durationCache[seg.Duration]
+		if !ok {
+			str = opts.formatDuration(seg.Duration)
+			durationCache[seg.Duration] = str
+		}
+		buf.WriteString(str)
+		buf.WriteRune(',')
+		buf.WriteString(seg.Title)
+		buf.WriteRune('\n')
+		buf.WriteString(seg.URI)
 		if p.Args != "" {
-			p.buf.WriteRune('?')
-			p.buf.WriteString(p.Args)
+			buf.WriteRune('?')
+			buf.WriteString(p.Args)
 		}
-		p.buf.WriteRune('\n')
+		buf.WriteRune('\n')
 	}
 	if p.Closed {
-		p.buf.WriteString("#EXT-X-ENDLIST\n")
+		buf.WriteString("#EXT-X-ENDLIST\n")
 	}
-	return &p.buf
 }
 
 // String here for compatibility with Stringer interface For example
@@ -729,7 +1146,7 @@ func (p *MediaPlaylist) DurationAsInt(yes bool) {
 		// duration must be integers if protocol version is less than 3
 		version(&p.ver, 3)
 	}
-	p.durationAsInt = yes
+	p.encoder.DurationAsInt = yes
 }
 
 // Count tells us the number of items that are currently in the media
@@ -741,7 +1158,8 @@ func (p *MediaPlaylist) Count() uint {
 // Close sliding playlist and make them fixed.
 func (p *MediaPlaylist) Close() {
 	if p.buf.Len() > 0 {
-		p.buf.WriteString("#EXT-X-ENDLIST\n")
+		p.buf.WriteString("#EXT-X-ENDLIST")
+		p.buf.WriteString(p.encoder.newline())
 	}
 	p.Closed = true
 }
@@ -860,17 +1278,35 @@ func (p *MediaPlaylist) SetProgramDateTime(value time.Time) error {
 }
 
 // SetCustomTag sets the provided tag on the media playlist for its
-// TagName.
+// TagName. It replaces all the tags with the same name.
 func (p *MediaPlaylist) SetCustomTag(tag CustomTag) {
-	if p.Custom == nil {
-		p.Custom = make(map[string]CustomTag)
+	setCustomTag(&p.Custom, &p.customOrder, tag.TagName(), tag)
+}
+
+// AddCustomTag adds the provided tag to the media playlist. Unlike
+// SetCustomTag it keeps the tags with the same name so the tag may
+// repeat.
+func (p *MediaPlaylist) AddCustomTag(tag CustomTag) {
+	addCustomTag(&p.Custom, &p.customOrder, tag.TagName(), tag)
+}
+
+// AddCustomSegmentTag adds the provided tag to the current media
+// segment. Unlike SetCustomSegmentTag it keeps the tags with the same
+// name so the tag may repeat.
+func (p *MediaPlaylist) AddCustomSegmentTag(tag CustomTag) error {
+	if p.count == 0 {
+		return errors.New("playlist is empty")
 	}
 
-	p.Custom[tag.TagName()] = tag
+	last := p.Segments[p.last()]
+	addCustomTag(&last.Custom, &last.customOrder, tag.TagName(), tag)
+
+	return nil
 }
 
 // SetCustomSegmentTag sets the provided tag on the current media
-// segment for its TagName.
+// segment for its TagName. It replaces all the tags with the same
+// name.
 func (p *MediaPlaylist) SetCustomSegmentTag(tag CustomTag) error {
 	if p.count == 0 {
 		return errors.New("playlist is empty")
@@ -878,13 +1314,199 @@ func (p *MediaPlaylist) SetCustomSegmentTag(tag CustomTag) error {
 
 	last := p.Segments[p.last()]
 
-	if last.Custom == nil {
-		last.Custom = make(map[string]CustomTag)
+	setCustomTag(&last.Custom, &last.customOrder, tag.TagName(), tag)
+
+	return nil
+}
+
+// setCustomTag stores the tag in the map of custom tags and remembers
+// the order in which the tags were added so Encode always outputs
+// them the same way. The replaced tags give up their positions except
+// the first one.
+func setCustomTag(custom *map[string]CustomTag, order *[]string, name string, tag CustomTag) {
+	if *custom == nil {
+		*custom = make(map[string]CustomTag)
 	}
+	if !containsString(*order, name) {
+		*order = append(*order, name)
+	} else if _, ok := (*custom)[name].(CustomTagList); ok {
+		kept, seen := (*order)[:0], false
+		for _, v := range *order {
+			if v == name {
+				if seen {
+					continue
+				}
+				seen = true
+			}
+			kept = append(kept, v)
+		}
+		*order = kept
+	}
+	(*custom)[name] = tag
+}
 
-	last.Custom[tag.TagName()] = tag
+// addCustomTag stores the tag in the map of custom tags. When a tag
+// with the same name is already there, both are kept in CustomTagList.
+// The order gets an entry for each tag, so the tags of different names
+// keep their interleaving.
+func addCustomTag(custom *map[string]CustomTag, order *[]string, name string, tag CustomTag) {
+	switch prev := (*custom)[name].(type) {
+	case nil:
+		setCustomTag(custom, order, name, tag)
+	case CustomTagList:
+		(*custom)[name] = append(prev, tag)
+		*order = append(*order, name)
+	default:
+		(*custom)[name] = CustomTagList{prev, tag}
+		*order = append(*order, name)
+	}
+}
 
-	return nil
+// writeCustomTags writes custom tags in the order they were added.
+// Tags put to the map directly, bypassing the setters, follow them
+// sorted by name, so the output is deterministic anyway.
+func writeCustomTags(buf *encodeWriter, custom map[string]CustomTag, order []string) {
+	for _, t := range orderedCustomTags(custom, order) {
+		writeCustomTag(buf, t.tag)
+	}
+}
+
+// orderedTag is the custom tag with the name it is stored under.
+type orderedTag struct {
+	name string
+	tag  CustomTag
+}
+
+// orderedCustomTags returns the custom tags one by one in the order of
+// Encode. The tags of CustomTagList take the positions of their name
+// in the order, the tags beyond these positions follow the last one.
+func orderedCustomTags(custom map[string]CustomTag, order []string) []orderedTag {
+	if len(custom) == 0 {
+		return nil
+	}
+	last := make(map[string]int, len(custom))
+	for i, name := range order {
+		if _, ok := custom[name]; ok {
+			last[name] = i
+		}
+	}
+	var (
+		tags = make([]orderedTag, 0, len(order))
+		used = make(map[string]int, len(last))
+	)
+	for i, name := range order {
+		list := CustomTags(custom, name)
+		n := used[name]
+		if n >= len(list) {
+			continue
+		}
+		if i == last[name] {
+			n = len(list)
+		} else {
+			n++
+		}
+		for _, tag := range list[used[name]:n] {
+			tags = append(tags, orderedTag{name, tag})
+		}
+		used[name] = n
+	}
+	if len(last) == len(custom) {
+		return tags
+	}
+	rest := make([]string, 0, len(custom)-len(last))
+	for name := range custom {
+		if _, ok := last[name]; !ok {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		for _, tag := range CustomTags(custom, name) {
+			tags = append(tags, orderedTag{name, tag})
+		}
+	}
+	return tags
+}
+
+func writeCustomTag(buf *encodeWriter, tag CustomTag) {
+	if tag == nil {
+		return
+	}
+	if customBuf := tag.Encode(); customBuf != nil {
+		// the line breaks of the tag are normalized to LF, so they end
+		// as the other lines of the output, CRLF is restored by buf
+		lines := strings.TrimRight(strings.ReplaceAll(customBuf.String(), "\r\n", "\n"), "\n")
+		if buf.strict {
+			// each line of the tag must be a tag or a comment
+			for _, line := range strings.Split(lines, "\n") {
+				if !strings.HasPrefix(line, "#") {
+					buf.invalid(tag.TagName(), fmt.Errorf("line %q is not a tag", line))
+				}
+			}
+		}
+		buf.WriteString(lines)
+		buf.WriteRune('\n')
+	}
+}
+
+// TagName returns the name of the tags in the list.
+func (l CustomTagList) TagName() string {
+	if len(l) == 0 {
+		return ""
+	}
+	return l[0].TagName()
+}
+
+// Encode encodes all the tags of the list line by line. Tags which
+// encode to nil are skipped.
+func (l CustomTagList) Encode() *bytes.Buffer {
+	var buf *bytes.Buffer
+	for _, tag := range l {
+		if tag == nil {
+			continue
+		}
+		tagBuf := tag.Encode()
+		if tagBuf == nil {
+			continue
+		}
+		if buf == nil {
+			buf = new(bytes.Buffer)
+		} else {
+			buf.WriteRune('\n')
+		}
+		buf.Write(tagBuf.Bytes())
+	}
+	return buf
+}
+
+// String returns the encoded tags as a string.
+func (l CustomTagList) String() string {
+	if buf := l.Encode(); buf != nil {
+		return buf.String()
+	}
+	return ""
+}
+
+// CustomTags returns all the instances of the named tag from the map
+// of custom tags regardless whether the tag repeats or not.
+func CustomTags(custom map[string]CustomTag, name string) []CustomTag {
+	switch tag := custom[name].(type) {
+	case nil:
+		return nil
+	case CustomTagList:
+		return tag
+	default:
+		return []CustomTag{tag}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // Version returns the current playlist version number
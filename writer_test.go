@@ -12,8 +12,13 @@ package m3u8
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
@@ -436,6 +441,78 @@ func TestEncodeMediaPlaylistWithCustomTags(t *testing.T) {
 	}
 }
 
+// Custom tags must be encoded in the order they were set, tags added
+// to the map directly follow them sorted by name.
+func TestEncodeMediaPlaylistCustomTagsOrder(t *testing.T) {
+	p, e := NewMediaPlaylist(1, 1)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	for _, name := range []string{"#Z-TAG", "#A-TAG", "#M-TAG"} {
+		p.SetCustomTag(&MockCustomTag{name: name, encodedString: name})
+	}
+	p.Custom["#B-TAG"] = &MockCustomTag{name: "#B-TAG", encodedString: "#B-TAG"}
+	if e = p.Append("test01.ts", 5.0, ""); e != nil {
+		t.Fatalf("Add 1st segment to a media playlist failed: %s", e)
+	}
+	for _, name := range []string{"#Z-SEG", "#A-SEG", "#M-SEG"} {
+		if e = p.SetCustomSegmentTag(&MockCustomTag{name: name, encodedString: name}); e != nil {
+			t.Fatalf("Set CustomTag to segment failed: %s", e)
+		}
+	}
+	// replacing the tag keeps its position
+	p.SetCustomTag(&MockCustomTag{name: "#A-TAG", encodedString: "#A-TAG:2"})
+
+	expected := "#Z-TAG\n#A-TAG:2\n#M-TAG\n#B-TAG\n"
+	expectedSegment := "#Z-SEG\n#A-SEG\n#M-SEG\n#EXTINF"
+	first := p.String()
+	if !strings.Contains(first, expected) || !strings.Contains(first, expectedSegment) {
+		t.Fatalf("Custom tags are out of order:\n%s", first)
+	}
+	for i := 0; i < 20; i++ {
+		p.ResetCache()
+		if out := p.String(); out != first {
+			t.Fatalf("Encode is not deterministic:\n%s\nvs\n%s", first, out)
+		}
+	}
+}
+
+// Repeated custom tags must be all encoded in the order they were added.
+func TestEncodeMediaPlaylistWithRepeatedCustomTags(t *testing.T) {
+	p, e := NewMediaPlaylist(1, 1)
+	if e != nil {
+		t.Fatalf("Create media playlist failed: %s", e)
+	}
+	p.AddCustomTag(&MockCustomTag{name: "#X-ASSET:", encodedString: "#X-ASSET:1"})
+	p.AddCustomTag(&MockCustomTag{name: "#X-OTHER", encodedString: "#X-OTHER"})
+	p.AddCustomTag(&MockCustomTag{name: "#X-ASSET:", encodedString: "#X-ASSET:2"})
+	if e = p.Append("test01.ts", 5.0, ""); e != nil {
+		t.Fatalf("Add 1st segment to a media playlist failed: %s", e)
+	}
+	for _, v := range []string{"#X-SEG:1", "#X-SEG:2", "#X-SEG:3"} {
+		if e = p.AddCustomSegmentTag(&MockCustomTag{name: "#X-SEG:", encodedString: v}); e != nil {
+			t.Fatalf("Add CustomTag to segment failed: %s", e)
+		}
+	}
+	if n := len(CustomTags(p.Segments[0].Custom, "#X-SEG:")); n != 3 {
+		t.Errorf("Got %d segment tags, expected 3", n)
+	}
+	encoded := p.String()
+	for _, expected := range []string{"#X-ASSET:1\n#X-OTHER\n#X-ASSET:2\n", "#X-SEG:1\n#X-SEG:2\n#X-SEG:3\n#EXTINF"} {
+		if !strings.Contains(encoded, expected) {
+			t.Errorf("Media playlist does not contain %q\nMedia Playlist:\n%v", expected, encoded)
+		}
+	}
+
+	// Set replaces all the instances of the tag
+	if e = p.SetCustomSegmentTag(&MockCustomTag{name: "#X-SEG:", encodedString: "#X-SEG:4"}); e != nil {
+		t.Fatalf("Set CustomTag to segment failed: %s", e)
+	}
+	if tags := CustomTags(p.Segments[0].Custom, "#X-SEG:"); len(tags) != 1 || tags[0].String() != "#X-SEG:4" {
+		t.Errorf("Got segment tags %v, expected only #X-SEG:4", tags)
+	}
+}
+
 // Create new media playlist
 // Add two segments to media playlist
 // Encode structures to HLS
@@ -589,7 +666,9 @@ func TestLargeMediaPlaylistWithParallel(t *testing.T) {
 		t.Fatal(err)
 	}
 	var wg sync.WaitGroup
-	var errChan = make(chan error, 1)
+	// every goroutine can report without blocking and the channel is
+	// closed after them, so the test doesn't hang when all of them pass
+	var errChan = make(chan error, testCount)
 	for i := 0; i < testCount; i++ {
 		wg.Add(1)
 		go func() {
@@ -616,6 +695,7 @@ func TestLargeMediaPlaylistWithParallel(t *testing.T) {
 		}()
 	}
 	wg.Wait()
+	close(errChan)
 	if err := <-errChan; err != nil {
 		t.Fatal(err)
 	}
@@ -638,6 +718,67 @@ func TestMediaSetVersion(t *testing.T) {
 	}
 }
 
+func TestMediaRequiredVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(p *MediaPlaylist)
+		expected string
+	}{
+		{"plain", func(p *MediaPlaylist) {}, "#EXT-X-VERSION:3\n"},
+		{"byte range", func(p *MediaPlaylist) { p.Segments[0].Limit = 100 }, "#EXT-X-VERSION:4\n"},
+		{"segment map", func(p *MediaPlaylist) {
+			p.Segments[0].Map = &Map{URI: "init.mp4"}
+		}, "#EXT-X-VERSION:6\n"},
+		{"I-frames with map", func(p *MediaPlaylist) {
+			p.Iframe = true
+			p.Map = &Map{URI: "init.mp4"}
+		}, "#EXT-X-VERSION:5\n"},
+		{"key format", func(p *MediaPlaylist) {
+			p.Segments[0].Key = &Key{Method: "SAMPLE-AES", URI: "skd://key", Keyformat: "com.apple.streamingkeydelivery"}
+		}, "#EXT-X-VERSION:5\n"},
+		{"explicit version", func(p *MediaPlaylist) { p.SetVersion(7) }, "#EXT-X-VERSION:7\n"},
+	}
+	for _, test := range tests {
+		p, err := NewMediaPlaylist(1, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = p.AppendSegment(&MediaSegment{URI: "a.ts", Duration: 10}); err != nil {
+			t.Fatal(err)
+		}
+		test.change(p)
+		if out := p.String(); !strings.Contains(out, test.expected) {
+			t.Errorf("%s: %q not found in\n%s", test.name, test.expected, out)
+		}
+	}
+}
+
+func TestMediaPinnedVersion(t *testing.T) {
+	p, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.AppendSegment(&MediaSegment{URI: "a.ts", Duration: 10, Map: &Map{URI: "init.mp4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := p.RequiredVersion(); v != 6 {
+		t.Errorf("Required version %d, expected 6", v)
+	}
+	p.SetEncoderOptions(EncoderOptions{Version: 7})
+	if !strings.Contains(p.String(), "#EXT-X-VERSION:7\n") {
+		t.Errorf("Version is not pinned:\n%s", p.String())
+	}
+	// the version required by the content wins over the lower one
+	p.SetEncoderOptions(EncoderOptions{Version: 5})
+	if !strings.Contains(p.String(), "#EXT-X-VERSION:6\n") {
+		t.Errorf("Version is pinned below the required one:\n%s", p.String())
+	}
+	var encErr *EncodeError
+	if _, err = p.EncodeStrict(); !errors.As(err, &encErr) || encErr.Tag != "#EXT-X-VERSION" {
+		t.Errorf("Got error %v, expected EncodeError of #EXT-X-VERSION", err)
+	}
+}
+
 func TestMediaWinSize(t *testing.T) {
 	m, _ := NewMediaPlaylist(3, 3)
 	if m.WinSize() != m.winsize {
@@ -953,6 +1094,287 @@ func TestMasterSetVersion(t *testing.T) {
 	}
 }
 
+func TestEncodeMediaPlaylistWithOptions(t *testing.T) {
+	p, err := NewMediaPlaylist(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Append("a.ts", 9.87654321, ""); err != nil {
+		t.Fatal(err)
+	}
+	pdt := time.Date(2019, 1, 2, 15, 4, 5, 120000000, time.FixedZone("MSK", 3*3600))
+	if err = p.SetProgramDateTime(pdt); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts     EncoderOptions
+		expected []string
+	}{
+		{EncoderOptions{}, []string{"#EXTINF:9.877,\n", "#EXT-X-PROGRAM-DATE-TIME:2019-01-02T15:04:05.12+03:00\n"}},
+		{EncoderOptions{DurationPrecision: 6}, []string{"#EXTINF:9.876543,\n"}},
+		{EncoderOptions{DurationPrecision: -1}, []string{"#EXTINF:9.87654321,\n"}},
+		{EncoderOptions{DurationAsInt: true}, []string{"#EXTINF:10,\n"}},
+		{
+			EncoderOptions{PDTLayout: DATETIME_MILLIS, PDTUTC: true},
+			[]string{"#EXT-X-PROGRAM-DATE-TIME:2019-01-02T12:04:05.120Z\n"},
+		},
+		{EncoderOptions{CRLF: true}, []string{"#EXTM3U\r\n", "#EXTINF:9.877,\r\na.ts\r\n"}},
+	}
+	for _, test := range tests {
+		out := p.EncodeWithOptions(test.opts).String()
+		for _, line := range test.expected {
+			if !strings.Contains(out, line) {
+				t.Errorf("Options %+v: %q not found in\n%s", test.opts, line, out)
+			}
+		}
+		if !test.opts.CRLF && strings.Contains(out, "\r") {
+			t.Errorf("Options %+v: unexpected CR in\n%s", test.opts, out)
+		}
+	}
+	if p.buf.Len() > 0 {
+		t.Error("EncodeWithOptions filled the cache")
+	}
+
+	p.SetEncoderOptions(EncoderOptions{CRLF: true})
+	p.Close()
+	if !strings.HasSuffix(p.String(), "a.ts\r\n#EXT-X-ENDLIST\r\n") {
+		t.Errorf("Unexpected playlist end:\n%q", p.String())
+	}
+
+	// line breaks of custom tags end as the other lines
+	p.SetCustomTag(&MockCustomTag{name: "#X-CRLF", encodedString: "#X-CRLF:1\r\n#X-CRLF:2\r\n"})
+	if _, err := p.EncodeStrict(); err != nil {
+		t.Errorf("Got error %v for custom tag with CRLF", err)
+	}
+	for _, opts := range []EncoderOptions{{CRLF: true}, {}} {
+		out := p.EncodeWithOptions(opts).String()
+		expected := "#X-CRLF:1\n#X-CRLF:2\n#EXT-X-MEDIA-SEQUENCE"
+		if opts.CRLF {
+			expected = strings.ReplaceAll(expected, "\n", "\r\n")
+		}
+		if !strings.Contains(out, expected) || strings.Contains(out, "\r\r") {
+			t.Errorf("Options %+v: %q not found in\n%q", opts, expected, out)
+		}
+	}
+}
+
+func TestEncodeMasterPlaylistWithOptions(t *testing.T) {
+	m := NewMasterPlaylist()
+	m.Append("chunklist.m3u8", nil, VariantParams{ProgramId: 1, Bandwidth: 1500000})
+	m.Append("iframes.m3u8", nil, VariantParams{ProgramId: 1, Bandwidth: 150000, Iframe: true})
+	if !strings.Contains(m.String(), "PROGRAM-ID=1,BANDWIDTH=1500000") {
+		t.Errorf("PROGRAM-ID not written:\n%s", m.String())
+	}
+	m.SetEncoderOptions(EncoderOptions{OmitDeprecated: true})
+	if out := m.String(); strings.Contains(out, "PROGRAM-ID") {
+		t.Errorf("PROGRAM-ID written:\n%s", out)
+	}
+	for _, opts := range []EncoderOptions{{Version: 6}, {Version: 5}} {
+		m.SetEncoderOptions(opts)
+		if out := m.String(); strings.Contains(out, "PROGRAM-ID") != (opts.Version < 6) {
+			t.Errorf("Version %d, got playlist\n%s", opts.Version, out)
+		}
+	}
+	m.SetEncoderOptions(EncoderOptions{})
+	m.SetVersion(7)
+	if out := m.String(); strings.Contains(out, "PROGRAM-ID") {
+		t.Errorf("PROGRAM-ID written for version 7:\n%s", out)
+	}
+}
+
+// failingWriter fails after the limit of bytes is written.
+type failingWriter struct {
+	limit int
+	n     int
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.n+len(b) > w.limit {
+		n := w.limit - w.n
+		w.n = w.limit
+		return n, errWriteFailed
+	}
+	w.n += len(b)
+	return len(b), nil
+}
+
+func TestMediaPlaylistWriteTo(t *testing.T) {
+	p, err := NewMediaPlaylist(0, 10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10000; i++ {
+		if err = p.Append(fmt.Sprintf("test%d.ts", i), 5.0, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	buf := new(bytes.Buffer)
+	n, err := p.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.buf.Len() > 0 {
+		t.Error("WriteTo filled the cache")
+	}
+	if n != int64(buf.Len()) || buf.String() != p.String() {
+		t.Errorf("WriteTo output differs from Encode output, %d bytes reported", n)
+	}
+
+	n, err = p.WriteTo(&failingWriter{limit: 10000})
+	if !errors.Is(err, errWriteFailed) || n != 10000 {
+		t.Errorf("Got %d, %v, expected 10000, %v", n, err, errWriteFailed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = p.WriteToContext(ctx, io.Discard); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got error %v, expected %v", err, context.Canceled)
+	}
+
+	p.SetEncoderOptions(EncoderOptions{CRLF: true})
+	buf.Reset()
+	if _, err = p.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != p.String() || strings.Count(buf.String(), "\r\n") != strings.Count(buf.String(), "\n") {
+		t.Error("WriteTo doesn't respect encoder options")
+	}
+}
+
+func TestMasterPlaylistWriteTo(t *testing.T) {
+	m := NewMasterPlaylist()
+	for i := 0; i < 3; i++ {
+		m.Append(fmt.Sprintf("chunklist%d.m3u8", i), nil, VariantParams{Bandwidth: uint32(1500000 * (i + 1))})
+	}
+	buf := new(bytes.Buffer)
+	if _, err := m.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != m.String() {
+		t.Errorf("WriteTo output differs from Encode output:\n%s", buf.String())
+	}
+	if _, err := m.WriteTo(&failingWriter{limit: 1}); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Got error %v, expected %v", err, errWriteFailed)
+	}
+}
+
+func TestEncodeStrictSamplePlaylists(t *testing.T) {
+	files, err := filepath.Glob("sample-playlists/*.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, _, err := DecodeFrom(bufio.NewReader(f), false)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		var out *bytes.Buffer
+		switch pp := p.(type) {
+		case *MasterPlaylist:
+			out, err = pp.EncodeStrict()
+		case *MediaPlaylist:
+			out, err = pp.EncodeStrict()
+		}
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+			continue
+		}
+		if out.String() != p.String() {
+			t.Errorf("%s: strict output differs from Encode output", file)
+		}
+	}
+}
+
+func TestEncodeStrictInvalidValues(t *testing.T) {
+	media := func(change func(p *MediaPlaylist)) func() (*bytes.Buffer, error) {
+		return func() (*bytes.Buffer, error) {
+			p, err := NewMediaPlaylist(1, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = p.Append("a.ts", 10, ""); err != nil {
+				t.Fatal(err)
+			}
+			change(p)
+			return p.EncodeStrict()
+		}
+	}
+	master := func(v VariantParams) func() (*bytes.Buffer, error) {
+		return func() (*bytes.Buffer, error) {
+			m := NewMasterPlaylist()
+			m.Append("chunklist.m3u8", nil, v)
+			return m.EncodeStrict()
+		}
+	}
+	alternative := &Alternative{GroupId: "aac", Type: "AUDIO", Name: "Director's \"cut\"\n"}
+	tests := []struct {
+		name   string
+		encode func() (*bytes.Buffer, error)
+		tag    string
+	}{
+		{"quoted name", master(VariantParams{Bandwidth: 1, Audio: "aac", Alternatives: []*Alternative{alternative}}), "#EXT-X-MEDIA"},
+		{"rendition without name", master(VariantParams{Bandwidth: 1, Alternatives: []*Alternative{{GroupId: "aac", Type: "AUDIO"}}}), "#EXT-X-MEDIA"},
+		{"bad resolution", master(VariantParams{Bandwidth: 1, Resolution: "wide"}), "#EXT-X-STREAM-INF"},
+		{"bad I-frame resolution", master(VariantParams{Iframe: true, Bandwidth: 1, Resolution: "wide"}), "#EXT-X-I-FRAME-STREAM-INF"},
+		{"key without URI", media(func(p *MediaPlaylist) { p.SetKey("AES-128", "", "", "", "") }), "#EXT-X-KEY"},
+		{"bad IV", media(func(p *MediaPlaylist) { p.SetKey("AES-128", "key", "123", "", "") }), "#EXT-X-KEY"},
+		{"URI with newline", media(func(p *MediaPlaylist) { p.Segments[0].URI = "a.ts\n#EXT-X-ENDLIST" }), "#EXTINF"},
+		{"negative byte range", media(func(p *MediaPlaylist) { p.SetRange(-100, 0) }), "#EXT-X-BYTERANGE"},
+		{"negative map offset", media(func(p *MediaPlaylist) { p.SetMap("init.mp4", 100, -1) }), "#EXT-X-MAP"},
+		{"NaN duration", media(func(p *MediaPlaylist) { p.Segments[0].Duration = math.NaN() }), "#EXTINF"},
+		{"title with newline", media(func(p *MediaPlaylist) { p.Segments[0].Title = "a\nb" }), "#EXTINF"},
+		{"custom tag line", media(func(p *MediaPlaylist) {
+			p.SetCustomTag(&MockCustomTag{name: "#X-TAG", encodedString: "#X-TAG\nuri"})
+		}), "#X-TAG"},
+	}
+	for _, test := range tests {
+		out, err := test.encode()
+		var encErr *EncodeError
+		if !errors.As(err, &encErr) {
+			t.Errorf("%s: got error %v, expected EncodeError", test.name, err)
+			continue
+		}
+		if encErr.Tag != test.tag {
+			t.Errorf("%s: got error of %s, expected %s", test.name, encErr.Tag, test.tag)
+		}
+		if out != nil {
+			t.Errorf("%s: got output for invalid playlist", test.name)
+		}
+	}
+
+	// Encode writes the invalid values as is and keeps the following attributes
+	m := NewMasterPlaylist()
+	m.Append("chunklist.m3u8", nil, VariantParams{Bandwidth: 1, Resolution: "1280 x 720", VideoRange: "PQ"})
+	if out := m.String(); !strings.Contains(out, "RESOLUTION=1280 x 720,VIDEO-RANGE=PQ\n") {
+		t.Errorf("Got playlist\n%s", out)
+	}
+	p, err := NewMediaPlaylist(1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetDefaultKey("", "key", "0x 12", "identity", "")
+	p.Append("a.ts\nb.ts", 10, "")
+	if out := p.String(); !strings.Contains(out, `#EXT-X-KEY:METHOD=,URI="key",IV=0x 12,KEYFORMAT="identity"`) {
+		t.Errorf("Got playlist\n%s", out)
+	}
+	if !strings.Contains(p.String(), "a.ts\nb.ts") {
+		t.Error("Encode must not validate the values")
+	}
+	p.SetEncoderOptions(EncoderOptions{Strict: true})
+	if _, err = p.WriteTo(io.Discard); err == nil {
+		t.Error("WriteTo with Strict option accepted invalid value")
+	}
+}
+
 /******************************
  *  Code generation examples  *
  ******************************/
@@ -1047,9 +1469,9 @@ func ExampleMasterPlaylist_String_with_hlsv7() {
 	// #EXTM3U
 	// #EXT-X-VERSION:7
 	// #EXT-X-INDEPENDENT-SEGMENTS
-	// #EXT-X-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=12886714,AVERAGE-BANDWIDTH=7964551,CODECS="hvc1.2.4.L123.B0",RESOLUTION=1920x1080,CLOSED-CAPTIONS=NONE,FRAME-RATE=23.976,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-0
+	// #EXT-X-STREAM-INF:BANDWIDTH=12886714,AVERAGE-BANDWIDTH=7964551,CODECS="hvc1.2.4.L123.B0",RESOLUTION=1920x1080,CLOSED-CAPTIONS=NONE,FRAME-RATE=23.976,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-0
 	// hdr10_1080/prog_index.m3u8
-	// #EXT-X-I-FRAME-STREAM-INF:PROGRAM-ID=0,BANDWIDTH=905053,AVERAGE-BANDWIDTH=364552,CODECS="hvc1.2.4.L123.B0",RESOLUTION=1920x1080,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-0,URI="hdr10_1080/iframe_index.m3u8"
+	// #EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=905053,AVERAGE-BANDWIDTH=364552,CODECS="hvc1.2.4.L123.B0",RESOLUTION=1920x1080,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-0,URI="hdr10_1080/iframe_index.m3u8"
 }
 
 func ExampleMediaPlaylist_Segments_scte35_oatcls() {
@@ -1165,3 +1587,23 @@ func BenchmarkEncodeMediaPlaylist(b *testing.B) {
 		_ = p.Encode() // disregard output
 	}
 }
+
+func BenchmarkWriteToMediaPlaylist(b *testing.B) {
+	f, err := os.Open("sample-playlists/media-playlist-large.m3u8")
+	if err != nil {
+		b.Fatal(err)
+	}
+	p, err := NewMediaPlaylist(50000, 50000)
+	if err != nil {
+		b.Fatalf("Create media playlist failed: %s", err)
+	}
+	if err = p.DecodeFrom(bufio.NewReader(f), true); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err = p.WriteTo(io.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}